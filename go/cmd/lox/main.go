@@ -1,20 +1,124 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	_lox "github.com/Shresth72/lox/internal/lox"
 )
 
 func main() {
-	lox := _lox.NewLox()
-	if len(os.Args) > 2 {
-		fmt.Println("Usage: lox {script}")
+	printAst := flag.Bool("ast", false, "print the parsed AST instead of evaluating it")
+	useVM := flag.Bool("vm", false, "run on the bytecode VM instead of the tree-walking interpreter")
+	noOptimize := flag.Bool("no-optimize", false, "skip constant folding and dead branch elimination")
+	gcStress := flag.Bool("gc-stress", false, "collect garbage before every VM allocation")
+	gcGrowth := flag.Float64("gc-growth", _lox.DefaultHeapGrowFactor, "factor the VM heap grows by between collections")
+	flag.Parse()
+
+	args := flag.Args()
+	runsBytecode := len(args) > 0 && (args[0] == "compile" || args[0] == "run")
+	// The tree-walker has no heap of its own for these to tune
+	if !*useVM && !runsBytecode {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "gc-stress" || f.Name == "gc-growth" {
+				fmt.Printf("Error: --%s only applies to the VM, add --vm\n", f.Name)
+				os.Exit(64)
+			}
+		})
+	}
+	// A heap that doesn't grow would collect on every allocation
+	if !(*gcGrowth > 1) {
+		fmt.Printf("Error: --gc-growth must be greater than 1, got %v\n", *gcGrowth)
+		os.Exit(64)
+	}
+
+	lox :=_lox.NewLox(os.Stdout, os.Stderr)
+	lox.PrintAst = *printAst
+	lox.NoOptimize = *noOptimize
+	lox.UseVM = *useVM
+	lox.GCStress = *gcStress
+	lox.HeapGrowFactor = *gcGrowth
+
+	if runsBytecode {
+		if err := runBytecodeCommand(lox, args[0], args[1:]); err != nil {
+			os.Exit(exitCode(err))
+		}
+	} else if len(args) > 1 {
+		fmt.Println("Usage: lox [--ast] [--no-optimize] [--vm] [--gc-stress] [--gc-growth=2] {script}")
+		fmt.Println("       lox compile {script} [-o out.loxc]")
+		fmt.Println("       lox run {out.loxc}")
 		os.Exit(64)
-	} else if len(os.Args) == 2 {
-		lox.RunFile(os.Args[1])
+	} else if len(args) == 1 {
+		if err := lox.RunFile(args[0]); err != nil {
+			os.Exit(exitCode(err))
+		}
+	} else if stdinIsPiped() {
+		// Piped input is one script, not lines typed at a prompt
+		if _, _, err := lox.RunReader(context.Background(), "<stdin>", os.Stdin); err != nil {
+			os.Exit(exitCode(err))
+		}
 	} else {
-		lox.RunPrompt()
+		lox.RunPrompt(os.Stdin)
+	}
+}
+
+// stdinIsPiped reports whether stdin is a pipe or file rather than a
+// terminal.
+func stdinIsPiped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// runBytecodeCommand handles "compile", which saves a script's bytecode to
+// a .loxc file, and "run", which executes one.
+func runBytecodeCommand(lox *_lox.Lox, command string, args []string) error {
+	if command == "run" {
+		if len(args) != 1 {
+			fmt.Println("Usage: lox run {out.loxc}")
+			os.Exit(64)
+		}
+		return lox.RunCompiledFile(args[0])
+	}
+
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	out := flags.String("o", "", "output file, defaults to the script with a .loxc extension")
+	flags.Parse(args)
+
+	// Allow the output flag after the script as well as before it
+	var in string
+	if flags.NArg() > 0 {
+		in = flags.Arg(0)
+		flags.Parse(flags.Args()[1:])
+	}
+	if in == "" || flags.NArg() != 0 {
+		fmt.Println("Usage: lox compile {script} [-o out.loxc]")
+		os.Exit(64)
+	}
+
+	if *out == "" {
+		*out = strings.TrimSuffix(in, filepath.Ext(in)) + ".loxc"
+	}
+	return lox.WriteCompiledFile(in, *out)
+}
+
+// exitCode maps a run failure to the sysexits.h code the book uses.
+func exitCode(err error) int {
+	var runtimeErr *_lox.RuntimeError
+	switch {
+	case errors.Is(err, _lox.ErrStatic):
+		return 65
+	case errors.Is(err, _lox.ErrInvalidBytecode):
+		fmt.Println("Error:", err)
+		return 65
+	case errors.As(err, &runtimeErr):
+		return 70
+	default:
+		fmt.Println("Error:", err)
+		return 1
 	}
 }
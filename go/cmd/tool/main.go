@@ -1,9 +1,12 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/Shresth72/lox/internal/lox"
 	"github.com/Shresth72/lox/internal/tool"
@@ -22,6 +25,10 @@ func main() {
 		runGenerateAst()
 	case "print_ast":
 		runPrintAst()
+	case "disasm":
+		runDisasm()
+	case "tokens":
+		runTokens()
 	default:
 		fmt.Printf("Tool: %s not supported\n", command)
 	}
@@ -47,8 +54,149 @@ func runGenerateAst() {
 	}
 }
 
+// runPrintAst prints the syntax tree of a script, or of a JSON AST to
+// check it round trips, as S-expressions or JSON. The rpn and dot formats
+// show how the top-level expressions parsed, in reverse Polish notation or
+// as a Graphviz graph. Without a file it prints a built-in example.
 func runPrintAst() {
-	fmt.Printf("Example AST: %s\n", lox.ExampleAst())
+	flags := flag.NewFlagSet("print_ast", flag.ExitOnError)
+	format := flags.String("format", "sexpr", "output format, sexpr, json, rpn or dot")
+	flags.Parse(os.Args[2:])
+
+	formats := []string{"sexpr", "json", "rpn", "dot"}
+	if flags.NArg() > 1 || !slices.Contains(formats, *format) {
+		fmt.Println("Usage: tool print_ast [--format=sexpr|json|rpn|dot] [{script} | {ast.json}]")
+		os.Exit(64)
+	}
+	if flags.NArg() == 0 {
+		fmt.Printf("Example AST: %s\n", lox.ExampleAst())
+		return
+	}
+
+	path := flags.Arg(0)
+	var statements []lox.Stmt
+	var err error
+	if filepath.Ext(path) == ".json" {
+		var data []byte
+		if data, err = os.ReadFile(path); err == nil {
+			statements, err = lox.UnmarshalAst(data)
+		}
+	} else {
+		statements, err = lox.NewLox(os.Stdout, os.Stderr).ParseFile(path)
+	}
+	if err != nil {
+		if !errors.Is(err, lox.ErrStatic) {
+			fmt.Println("Error:", err)
+		}
+		os.Exit(65)
+	}
+
+	switch *format {
+	case "json":
+		data, err := lox.MarshalAst(statements)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	case "rpn":
+		printer := lox.NewRpnPrinter()
+		for _, expr := range topLevelExprs(statements) {
+			fmt.Println(printer.Print(expr))
+		}
+	case "dot":
+		fmt.Print(lox.NewDotPrinter().Print(topLevelExprs(statements)...))
+	default:
+		printer := lox.NewAstPrinter()
+		for _, statement := range statements {
+			fmt.Println(printer.PrintStmt(statement))
+		}
+	}
+}
+
+// topLevelExprs returns the expressions of the top-level expression, print
+// and var statements, the ones worth looking at to see precedence.
+func topLevelExprs(statements []lox.Stmt) []lox.Expr {
+	exprs := []lox.Expr{}
+	for _, statement := range statements {
+		switch stmt := statement.(type) {
+		case *lox.Expression:
+			exprs = append(exprs, stmt.Expression)
+		case *lox.Print:
+			exprs = append(exprs, stmt.Expression)
+		case *lox.Var:
+			if stmt.Initializer != nil {
+				exprs = append(exprs, stmt.Initializer)
+			}
+		}
+	}
+	return exprs
+}
+
+// runDisasm prints the bytecode a script compiles to and, with --trace,
+// runs it showing the VM's stack before every instruction.
+func runDisasm() {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	trace := flags.Bool("trace", false, "execute the bytecode, printing the stack before every instruction")
+	flags.Parse(os.Args[2:])
+
+	if flags.NArg() != 1 {
+		fmt.Println("Usage: tool disasm [--trace] {script}")
+		os.Exit(64)
+	}
+	path := flags.Arg(0)
+
+	l := lox.NewLox(os.Stdout, os.Stderr)
+	function, err := l.CompileFile(path)
+	if err != nil {
+		if !errors.Is(err, lox.ErrStatic) {
+			fmt.Println("Error:", err)
+		}
+		os.Exit(65)
+	}
+	lox.DisassembleFunction(os.Stdout, function)
+
+	if *trace {
+		fmt.Println()
+		l.UseVM = true
+		l.Trace = true
+		if err := l.RunFile(path); err != nil {
+			os.Exit(70)
+		}
+	}
+}
+
+// runTokens prints every token a script scans to, as an aligned table or
+// as JSON lines for other tools to read.
+func runTokens() {
+	flags := flag.NewFlagSet("tokens", flag.ExitOnError)
+	format := flags.String("format", "table", "output format, table or json")
+	flags.Parse(os.Args[2:])
+
+	if flags.NArg() != 1 || (*format != "table" && *format != "json") {
+		fmt.Println("Usage: tool tokens [--format=table|json] {script}")
+		os.Exit(64)
+	}
+
+	l := lox.NewLox(os.Stdout, os.Stderr)
+	tokens, err := l.ScanFile(flags.Arg(0))
+	if err != nil && !errors.Is(err, lox.ErrStatic) {
+		fmt.Println("Error:", err)
+		os.Exit(65)
+	}
+
+	write := lox.WriteTokenTable
+	if *format == "json" {
+		write = lox.WriteTokenJSON
+	}
+	if err := write(os.Stdout, tokens); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	// Tokens of a script with lexical errors are still printed
+	if err != nil {
+		os.Exit(65)
+	}
 }
 
 func findProjectRoot() (string, error) {
@@ -6,9 +6,17 @@ type Expr interface {
 
 type ExprVisitor interface {
 	VisitBinaryExpr(expr *Binary) interface{}
+	VisitCallExpr(expr *Call) interface{}
+	VisitAssignExpr(expr *Assign) interface{}
+	VisitGetExpr(expr *Get) interface{}
 	VisitGroupingExpr(expr *Grouping) interface{}
 	VisitLiteralExpr(expr *Literal) interface{}
+	VisitLogicalExpr(expr *Logical) interface{}
+	VisitSetExpr(expr *Set) interface{}
+	VisitSuperExpr(expr *Super) interface{}
+	VisitThisExpr(expr *This) interface{}
 	VisitUnaryExpr(expr *Unary) interface{}
+	VisitVariableExpr(expr *Variable) interface{}
 }
 
 type Binary struct {
@@ -29,13 +37,70 @@ func (e *Binary) Accept(v ExprVisitor) interface{} {
 	return v.VisitBinaryExpr(e)
 }
 
+type Call struct {
+	Callee    Expr
+	Paren     Token
+	Arguments []Expr
+}
+
+func NewCall(callee Expr, paren Token, arguments []Expr) *Call {
+	return &Call{
+		Callee:    callee,
+		Paren:     paren,
+		Arguments: arguments,
+	}
+}
+
+func (e *Call) Accept(v ExprVisitor) interface{} {
+	return v.VisitCallExpr(e)
+}
+
+type Assign struct {
+	Name  Token
+	Value Expr
+
+	// Set by the Resolver
+	Depth int
+}
+
+func NewAssign(name Token, value Expr) *Assign {
+	return &Assign{
+		Name:  name,
+		Value: value,
+	}
+}
+
+func (e *Assign) Accept(v ExprVisitor) interface{} {
+	return v.VisitAssignExpr(e)
+}
+
+type Get struct {
+	Object Expr
+	Name   Token
+}
+
+func NewGet(object Expr, name Token) *Get {
+	return &Get{
+		Object: object,
+		Name:   name,
+	}
+}
+
+func (e *Get) Accept(v ExprVisitor) interface{} {
+	return v.VisitGetExpr(e)
+}
+
 type Grouping struct {
+	LeftParen  Token
 	Expression Expr
+	RightParen Token
 }
 
-func NewGrouping(expression Expr) *Grouping {
+func NewGrouping(leftParen Token, expression Expr, rightParen Token) *Grouping {
 	return &Grouping{
+		LeftParen:  leftParen,
 		Expression: expression,
+		RightParen: rightParen,
 	}
 }
 
@@ -45,11 +110,15 @@ func (e *Grouping) Accept(v ExprVisitor) interface{} {
 
 type Literal struct {
 	Value any
+	Token Token
+	Span  Span
 }
 
-func NewLiteral(value any) *Literal {
+func NewLiteral(value any, token Token, span Span) *Literal {
 	return &Literal{
 		Value: value,
+		Token: token,
+		Span:  span,
 	}
 }
 
@@ -57,6 +126,78 @@ func (e *Literal) Accept(v ExprVisitor) interface{} {
 	return v.VisitLiteralExpr(e)
 }
 
+type Logical struct {
+	Left     Expr
+	Operator Token
+	Right    Expr
+}
+
+func NewLogical(left Expr, operator Token, right Expr) *Logical {
+	return &Logical{
+		Left:     left,
+		Operator: operator,
+		Right:    right,
+	}
+}
+
+func (e *Logical) Accept(v ExprVisitor) interface{} {
+	return v.VisitLogicalExpr(e)
+}
+
+type Set struct {
+	Object Expr
+	Name   Token
+	Value  Expr
+}
+
+func NewSet(object Expr, name Token, value Expr) *Set {
+	return &Set{
+		Object: object,
+		Name:   name,
+		Value:  value,
+	}
+}
+
+func (e *Set) Accept(v ExprVisitor) interface{} {
+	return v.VisitSetExpr(e)
+}
+
+type Super struct {
+	Keyword Token
+	Method  Token
+
+	// Set by the Resolver
+	Depth int
+}
+
+func NewSuper(keyword Token, method Token) *Super {
+	return &Super{
+		Keyword: keyword,
+		Method:  method,
+	}
+}
+
+func (e *Super) Accept(v ExprVisitor) interface{} {
+	return v.VisitSuperExpr(e)
+}
+
+type This struct {
+	Keyword Token
+
+	// Set by the Resolver
+	Depth int
+}
+
+func NewThis(keyword Token) *This {
+	return &This{
+		Keyword: keyword,
+	}
+}
+
+func (e *This) Accept(v ExprVisitor) interface{} {
+	return v.VisitThisExpr(e)
+}
+
 type Unary struct {
 	Operator Token
 	Right    Expr
@@ -72,3 +213,20 @@ func NewUnary(operator Token, right Expr) *Unary {
 func (e *Unary) Accept(v ExprVisitor) interface{} {
 	return v.VisitUnaryExpr(e)
 }
+
+type Variable struct {
+	Name Token
+
+	// Set by the Resolver
+	Depth int
+}
+
+func NewVariable(name Token) *Variable {
+	return &Variable{
+		Name: name,
+	}
+}
+
+func (e *Variable) Accept(v ExprVisitor) interface{} {
+	return v.VisitVariableExpr(e)
+}
@@ -0,0 +1,161 @@
+package lox
+
+type Stmt interface {
+	Accept(v StmtVisitor) interface{}
+}
+
+type StmtVisitor interface {
+	VisitBlockStmt(stmt *Block) interface{}
+	VisitClassStmt(stmt *Class) interface{}
+	VisitExpressionStmt(stmt *Expression) interface{}
+	VisitFunctionStmt(stmt *Function) interface{}
+	VisitIfStmt(stmt *If) interface{}
+	VisitPrintStmt(stmt *Print) interface{}
+	VisitReturnStmt(stmt *Return) interface{}
+	VisitVarStmt(stmt *Var) interface{}
+	VisitWhileStmt(stmt *While) interface{}
+}
+
+type Block struct {
+	Statements []Stmt
+}
+
+func NewBlock(statements []Stmt) *Block {
+	return &Block{
+		Statements: statements,
+	}
+}
+
+func (s *Block) Accept(v StmtVisitor) interface{} {
+	return v.VisitBlockStmt(s)
+}
+
+type Class struct {
+	Name       Token
+	Superclass *Variable
+	Methods    []*Function
+}
+
+func NewClass(name Token, superclass *Variable, methods []*Function) *Class {
+	return &Class{
+		Name:       name,
+		Superclass: superclass,
+		Methods:    methods,
+	}
+}
+
+func (s *Class) Accept(v StmtVisitor) interface{} {
+	return v.VisitClassStmt(s)
+}
+
+type Expression struct {
+	Expression Expr
+}
+
+func NewExpression(expression Expr) *Expression {
+	return &Expression{
+		Expression: expression,
+	}
+}
+
+func (s *Expression) Accept(v StmtVisitor) interface{} {
+	return v.VisitExpressionStmt(s)
+}
+
+type Function struct {
+	Name   Token
+	Params []Token
+	Body   []Stmt
+}
+
+func NewFunction(name Token, params []Token, body []Stmt) *Function {
+	return &Function{
+		Name:   name,
+		Params: params,
+		Body:   body,
+	}
+}
+
+func (s *Function) Accept(v StmtVisitor) interface{} {
+	return v.VisitFunctionStmt(s)
+}
+
+type If struct {
+	Condition  Expr
+	ThenBranch Stmt
+	ElseBranch Stmt
+}
+
+func NewIf(condition Expr, thenBranch Stmt, elseBranch Stmt) *If {
+	return &If{
+		Condition:  condition,
+		ThenBranch: thenBranch,
+		ElseBranch: elseBranch,
+	}
+}
+
+func (s *If) Accept(v StmtVisitor) interface{} {
+	return v.VisitIfStmt(s)
+}
+
+type Print struct {
+	Expression Expr
+}
+
+func NewPrint(expression Expr) *Print {
+	return &Print{
+		Expression: expression,
+	}
+}
+
+func (s *Print) Accept(v StmtVisitor) interface{} {
+	return v.VisitPrintStmt(s)
+}
+
+type Return struct {
+	Keyword Token
+	Value   Expr
+}
+
+func NewReturn(keyword Token, value Expr) *Return {
+	return &Return{
+		Keyword: keyword,
+		Value:   value,
+	}
+}
+
+func (s *Return) Accept(v StmtVisitor) interface{} {
+	return v.VisitReturnStmt(s)
+}
+
+type Var struct {
+	Name        Token
+	Initializer Expr
+}
+
+func NewVar(name Token, initializer Expr) *Var {
+	return &Var{
+		Name:        name,
+		Initializer: initializer,
+	}
+}
+
+func (s *Var) Accept(v StmtVisitor) interface{} {
+	return v.VisitVarStmt(s)
+}
+
+type While struct {
+	Condition Expr
+	Body      Stmt
+}
+
+func NewWhile(condition Expr, body Stmt) *While {
+	return &While{
+		Condition: condition,
+		Body:      body,
+	}
+}
+
+func (s *While) Accept(v StmtVisitor) interface{} {
+	return v.VisitWhileStmt(s)
+}
@@ -0,0 +1,523 @@
+package lox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// The JSON form of a program is an array of statements. Each node is an
+// object whose "kind" names its type, like "Binary" or "While", followed by
+// its fields under their Go names in camel case. Tokens keep their type,
+// lexeme and position, and literals are tagged with their type so 5, 5.0
+// and "5" stay apart:
+//
+//	{"kind": "Literal", "type": "int", "value": 5, "token": {...}}
+//
+// Absent optional children, like an if without an else, are null.
+
+// ErrInvalidAst is wrapped by every error from decoding a JSON AST that
+// isn't one MarshalAst could have written.
+var ErrInvalidAst = errors.New("invalid AST")
+
+// MarshalAst encodes statements as indented JSON.
+func MarshalAst(statements []Stmt) ([]byte, error) {
+	return json.MarshalIndent(astEncoder{}.stmts(statements), "", "  ")
+}
+
+// MarshalExpr encodes a single expression as indented JSON.
+func MarshalExpr(expr Expr) ([]byte, error) {
+	return json.MarshalIndent(astEncoder{}.expr(expr), "", "  ")
+}
+
+// UnmarshalAst rebuilds the statements MarshalAst encoded.
+func UnmarshalAst(data []byte) (statements []Stmt, err error) {
+	defer recoverAstError(&err)
+	return astDecoder{}.stmts(data), nil
+}
+
+// UnmarshalExpr rebuilds the expression MarshalExpr encoded.
+func UnmarshalExpr(data []byte) (expr Expr, err error) {
+	defer recoverAstError(&err)
+	return astDecoder{}.expr(data), nil
+}
+
+// astToken is the JSON form of a Token. A token's literal is kept by the
+// Literal node that owns it.
+type astToken struct {
+	Type   string `json:"type"`
+	Lexeme string `json:"lexeme"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+}
+
+// jsonObject is a JSON object that keeps its fields in order, so "kind"
+// comes first.
+type jsonObject []jsonField
+
+type jsonField struct {
+	key   string
+	value any
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for idx, field := range o {
+		if idx > 0 {
+			buffer.WriteByte(',')
+		}
+		key, err := json.Marshal(field.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+// node builds a node of kind from alternating keys and values.
+func node(kind string, keyValues ...any) jsonObject {
+	object := jsonObject{{"kind", kind}}
+	for idx := 0; idx < len(keyValues); idx += 2 {
+		object = append(object, jsonField{keyValues[idx].(string), keyValues[idx+1]})
+	}
+	return object
+}
+
+// Encoding
+
+// astEncoder turns nodes into jsonObjects for encoding/json to write.
+type astEncoder struct{}
+
+// Statements
+func (e astEncoder) VisitBlockStmt(stmt *Block) interface{} {
+	return node("Block", "statements", e.stmts(stmt.Statements))
+}
+
+func (e astEncoder) VisitClassStmt(stmt *Class) interface{} {
+	var superclass any
+	if stmt.Superclass != nil {
+		superclass = e.expr(stmt.Superclass)
+	}
+	methods := []any{}
+	for _, method := range stmt.Methods {
+		methods = append(methods, e.stmt(method))
+	}
+	return node("Class", "name", e.token(stmt.Name), "superclass", superclass, "methods", methods)
+}
+
+func (e astEncoder) VisitExpressionStmt(stmt *Expression) interface{} {
+	return node("Expression", "expression", e.expr(stmt.Expression))
+}
+
+func (e astEncoder) VisitFunctionStmt(stmt *Function) interface{} {
+	params := []astToken{}
+	for _, param := range stmt.Params {
+		params = append(params, e.token(param))
+	}
+	return node("Function", "name", e.token(stmt.Name), "params", params, "body", e.stmts(stmt.Body))
+}
+
+func (e astEncoder) VisitIfStmt(stmt *If) interface{} {
+	return node("If", "condition", e.expr(stmt.Condition),
+		"thenBranch", e.stmt(stmt.ThenBranch), "elseBranch", e.stmt(stmt.ElseBranch))
+}
+
+func (e astEncoder) VisitPrintStmt(stmt *Print) interface{} {
+	return node("Print", "expression", e.expr(stmt.Expression))
+}
+
+func (e astEncoder) VisitReturnStmt(stmt *Return) interface{} {
+	return node("Return", "keyword", e.token(stmt.Keyword), "value", e.expr(stmt.Value))
+}
+
+func (e astEncoder) VisitVarStmt(stmt *Var) interface{} {
+	return node("Var", "name", e.token(stmt.Name), "initializer", e.expr(stmt.Initializer))
+}
+
+func (e astEncoder) VisitWhileStmt(stmt *While) interface{} {
+	return node("While", "condition", e.expr(stmt.Condition), "body", e.stmt(stmt.Body))
+}
+
+// Expressions
+func (e astEncoder) VisitAssignExpr(expr *Assign) interface{} {
+	return node("Assign", "name", e.token(expr.Name), "value", e.expr(expr.Value))
+}
+
+func (e astEncoder) VisitBinaryExpr(expr *Binary) interface{} {
+	return node("Binary", "left", e.expr(expr.Left), "operator", e.token(expr.Operator), "right", e.expr(expr.Right))
+}
+
+func (e astEncoder) VisitCallExpr(expr *Call) interface{} {
+	arguments := []any{}
+	for _, argument := range expr.Arguments {
+		arguments = append(arguments, e.expr(argument))
+	}
+	return node("Call", "callee", e.expr(expr.Callee), "paren", e.token(expr.Paren), "arguments", arguments)
+}
+
+func (e astEncoder) VisitGetExpr(expr *Get) interface{} {
+	return node("Get", "object", e.expr(expr.Object), "name", e.token(expr.Name))
+}
+
+func (e astEncoder) VisitGroupingExpr(expr *Grouping) interface{} {
+	return node("Grouping", "leftParen", e.token(expr.LeftParen), "expression", e.expr(expr.Expression), "rightParen", e.token(expr.RightParen))
+}
+
+func (e astEncoder) VisitLiteralExpr(expr *Literal) interface{} {
+	var literalType string
+	value := expr.Value
+	switch v := expr.Value.(type) {
+	case nil:
+		literalType = "nil"
+	case bool:
+		literalType = "bool"
+	case int64:
+		literalType = "int"
+	case float64:
+		literalType = "float"
+		// JSON has no NaN or infinities, which folding can produce
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			value = strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	case string:
+		literalType = "string"
+	default:
+		panic(fmt.Sprintf("cannot encode literal %v of type %T", v, v))
+	}
+	return node("Literal", "type", literalType, "value", value, "token", e.token(expr.Token))
+}
+
+func (e astEncoder) VisitLogicalExpr(expr *Logical) interface{} {
+	return node("Logical", "left", e.expr(expr.Left), "operator", e.token(expr.Operator), "right", e.expr(expr.Right))
+}
+
+func (e astEncoder) VisitSetExpr(expr *Set) interface{} {
+	return node("Set", "object", e.expr(expr.Object), "name", e.token(expr.Name), "value", e.expr(expr.Value))
+}
+
+func (e astEncoder) VisitSuperExpr(expr *Super) interface{} {
+	return node("Super", "keyword", e.token(expr.Keyword), "method", e.token(expr.Method))
+}
+
+func (e astEncoder) VisitThisExpr(expr *This) interface{} {
+	return node("This", "keyword", e.token(expr.Keyword))
+}
+
+func (e astEncoder) VisitUnaryExpr(expr *Unary) interface{} {
+	return node("Unary", "operator", e.token(expr.Operator), "right", e.expr(expr.Right))
+}
+
+func (e astEncoder) VisitVariableExpr(expr *Variable) interface{} {
+	return node("Variable", "name", e.token(expr.Name))
+}
+
+// Helpers
+func (e astEncoder) stmts(statements []Stmt) []any {
+	encoded := []any{}
+	for _, statement := range statements {
+		encoded = append(encoded, e.stmt(statement))
+	}
+	return encoded
+}
+
+// stmt and expr encode nil as null.
+func (e astEncoder) stmt(stmt Stmt) any {
+	if stmt == nil {
+		return nil
+	}
+	return stmt.Accept(e)
+}
+
+func (e astEncoder) expr(expr Expr) any {
+	if expr == nil {
+		return nil
+	}
+	return expr.Accept(e)
+}
+
+func (e astEncoder) token(token Token) astToken {
+	return astToken{
+		Type:   token.Type.String(),
+		Lexeme: token.Lexeme,
+		Line:   token.Line,
+		Column: token.Column,
+		Offset: token.Offset,
+	}
+}
+
+// Decoding
+
+// astDecoder rebuilds nodes from JSON. It panics with an astError on
+// malformed input, which the Unmarshal functions recover.
+type astDecoder struct{}
+
+type astError struct {
+	message string
+}
+
+func recoverAstError(err *error) {
+	if r := recover(); r != nil {
+		astErr, ok := r.(*astError)
+		if !ok {
+			panic(r)
+		}
+		*err = fmt.Errorf("%w: %s", ErrInvalidAst, astErr.message)
+	}
+}
+
+func (d astDecoder) fail(format string, args ...any) {
+	panic(&astError{message: fmt.Sprintf(format, args...)})
+}
+
+func (d astDecoder) unmarshal(data []byte, v any) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Keeps ints too large for a float64 exact
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		d.fail("%s", err)
+	}
+}
+
+// jsonNode is a node object waiting to be decoded.
+type jsonNode struct {
+	kind   string
+	fields map[string]json.RawMessage
+}
+
+// node decodes data into a jsonNode, or returns false if it's null.
+func (d astDecoder) node(data []byte) (jsonNode, bool) {
+	var fields map[string]json.RawMessage
+	d.unmarshal(data, &fields)
+	if fields == nil {
+		return jsonNode{}, false
+	}
+
+	var kind string
+	if data, ok := fields["kind"]; ok {
+		d.unmarshal(data, &kind)
+	}
+	if kind == "" {
+		d.fail("node has no kind")
+	}
+	return jsonNode{kind: kind, fields: fields}, true
+}
+
+// field returns the field key of n, which must be present.
+func (d astDecoder) field(n jsonNode, key string) []byte {
+	data, ok := n.fields[key]
+	if !ok {
+		d.fail("%s has no %q", n.kind, key)
+	}
+	return data
+}
+
+// optional returns the field key of n, or null if it's left out.
+func (d astDecoder) optional(n jsonNode, key string) []byte {
+	if data, ok := n.fields[key]; ok {
+		return data
+	}
+	return []byte("null")
+}
+
+func (d astDecoder) stmts(data []byte) []Stmt {
+	var encoded []json.RawMessage
+	d.unmarshal(data, &encoded)
+	statements := []Stmt{}
+	for _, statement := range encoded {
+		statements = append(statements, d.stmt(statement))
+	}
+	return statements
+}
+
+func (d astDecoder) stmt(data []byte) Stmt {
+	stmt := d.optionalStmt(data)
+	if stmt == nil {
+		d.fail("expected a statement, found null")
+	}
+	return stmt
+}
+
+func (d astDecoder) optionalStmt(data []byte) Stmt {
+	n, ok := d.node(data)
+	if !ok {
+		return nil
+	}
+
+	switch n.kind {
+	case "Block":
+		return NewBlock(d.stmts(d.field(n, "statements")))
+	case "Class":
+		var superclass *Variable
+		if expr := d.optionalExpr(d.optional(n, "superclass")); expr != nil {
+			variable, ok := expr.(*Variable)
+			if !ok {
+				d.fail("Class superclass must be a Variable")
+			}
+			superclass = variable
+		}
+		methods := []*Function{}
+		for _, stmt := range d.stmts(d.field(n, "methods")) {
+			method, ok := stmt.(*Function)
+			if !ok {
+				d.fail("Class methods must be Functions")
+			}
+			methods = append(methods, method)
+		}
+		return NewClass(d.token(d.field(n, "name")), superclass, methods)
+	case "Expression":
+		return NewExpression(d.expr(d.field(n, "expression")))
+	case "Function":
+		var encoded []json.RawMessage
+		d.unmarshal(d.field(n, "params"), &encoded)
+		params := []Token{}
+		for _, param := range encoded {
+			params = append(params, d.token(param))
+		}
+		return NewFunction(d.token(d.field(n, "name")), params, d.stmts(d.field(n, "body")))
+	case "If":
+		return NewIf(d.expr(d.field(n, "condition")), d.stmt(d.field(n, "thenBranch")),
+			d.optionalStmt(d.optional(n, "elseBranch")))
+	case "Print":
+		return NewPrint(d.expr(d.field(n, "expression")))
+	case "Return":
+		return NewReturn(d.token(d.field(n, "keyword")), d.optionalExpr(d.optional(n, "value")))
+	case "Var":
+		return NewVar(d.token(d.field(n, "name")), d.optionalExpr(d.optional(n, "initializer")))
+	case "While":
+		return NewWhile(d.expr(d.field(n, "condition")), d.stmt(d.field(n, "body")))
+	}
+	d.fail("unknown statement kind %q", n.kind)
+	return nil
+}
+
+func (d astDecoder) exprs(data []byte) []Expr {
+	var encoded []json.RawMessage
+	d.unmarshal(data, &encoded)
+	exprs := []Expr{}
+	for _, expr := range encoded {
+		exprs = append(exprs, d.expr(expr))
+	}
+	return exprs
+}
+
+func (d astDecoder) expr(data []byte) Expr {
+	expr := d.optionalExpr(data)
+	if expr == nil {
+		d.fail("expected an expression, found null")
+	}
+	return expr
+}
+
+func (d astDecoder) optionalExpr(data []byte) Expr {
+	n, ok := d.node(data)
+	if !ok {
+		return nil
+	}
+
+	switch n.kind {
+	case "Assign":
+		return NewAssign(d.token(d.field(n, "name")), d.expr(d.field(n, "value")))
+	case "Binary":
+		return NewBinary(d.expr(d.field(n, "left")), d.token(d.field(n, "operator")), d.expr(d.field(n, "right")))
+	case "Call":
+		return NewCall(d.expr(d.field(n, "callee")), d.token(d.field(n, "paren")), d.exprs(d.field(n, "arguments")))
+	case "Get":
+		return NewGet(d.expr(d.field(n, "object")), d.token(d.field(n, "name")))
+	case "Grouping":
+		return NewGrouping(d.token(d.field(n, "leftParen")), d.expr(d.field(n, "expression")), d.token(d.field(n, "rightParen")))
+	case "Literal":
+		return d.literal(n)
+	case "Logical":
+		return NewLogical(d.expr(d.field(n, "left")), d.token(d.field(n, "operator")), d.expr(d.field(n, "right")))
+	case "Set":
+		return NewSet(d.expr(d.field(n, "object")), d.token(d.field(n, "name")), d.expr(d.field(n, "value")))
+	case "Super":
+		return NewSuper(d.token(d.field(n, "keyword")), d.token(d.field(n, "method")))
+	case "This":
+		return NewThis(d.token(d.field(n, "keyword")))
+	case "Unary":
+		return NewUnary(d.token(d.field(n, "operator")), d.expr(d.field(n, "right")))
+	case "Variable":
+		return NewVariable(d.token(d.field(n, "name")))
+	}
+	d.fail("unknown expression kind %q", n.kind)
+	return nil
+}
+
+func (d astDecoder) literal(n jsonNode) *Literal {
+	var literalType string
+	d.unmarshal(d.field(n, "type"), &literalType)
+	data := d.field(n, "value")
+
+	var value any
+	switch literalType {
+	case "nil":
+		if string(data) != "null" {
+			d.fail("nil literal has value %s", data)
+		}
+	case "bool":
+		var b bool
+		d.unmarshal(data, &b)
+		value = b
+	case "int":
+		var number json.Number
+		d.unmarshal(data, &number)
+		i, err := strconv.ParseInt(number.String(), 10, 64)
+		if err != nil {
+			d.fail("invalid int literal %s", data)
+		}
+		value = i
+	case "float":
+		// A number, or a string for NaN and the infinities
+		var text string
+		if bytes.HasPrefix(data, []byte(`"`)) {
+			d.unmarshal(data, &text)
+		} else {
+			var number json.Number
+			d.unmarshal(data, &number)
+			text = number.String()
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			d.fail("invalid float literal %s", data)
+		}
+		value = f
+	case "string":
+		var s string
+		d.unmarshal(data, &s)
+		value = s
+	default:
+		d.fail("unknown literal type %q", literalType)
+	}
+
+	token := d.token(d.field(n, "token"))
+	if token.Type == NUMBER || token.Type == STRING {
+		token.Literal = value
+	}
+	return NewLiteral(value, token, token.Span())
+}
+
+func (d astDecoder) token(data []byte) Token {
+	var encoded astToken
+	d.unmarshal(data, &encoded)
+	for tokenType := range EOF + 1 {
+		if tokenType.String() == encoded.Type {
+			return *NewToken(tokenType, encoded.Lexeme, nil, encoded.Line, encoded.Column, encoded.Offset)
+		}
+	}
+	d.fail("unknown token type %q", encoded.Type)
+	return Token{}
+}
@@ -0,0 +1,165 @@
+package lox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// astSource has every kind of statement and expression.
+const astSource = `
+var empty;
+var values = nil or true and !false;
+var numbers = -(1 + 2.5) * 3 / 4 - 5 % 6;
+class Base {
+  init(name) { this.name = name; }
+  greet() { return "hi " + this.name; }
+}
+class Derived < Base {
+  greet() {
+    var greeting = super.greet();
+    return greeting;
+  }
+  nothing() { return; }
+}
+fun count(limit) {
+  var n = 0;
+  while (n < limit) {
+    n = n + 1;
+  }
+  if (n >= limit) print n; else print -n;
+  if (n != 0) { print n == limit; }
+  return n;
+}
+var d = Derived("lox");
+d.extra = count(3) <= 3 and 2 > 1;
+print d.greet();
+`
+
+var astKinds = []string{
+	"Assign", "Binary", "Call", "Get", "Grouping", "Literal", "Logical", "Set", "Super", "This", "Unary", "Variable",
+	"Block", "Class", "Expression", "Function", "If", "Print", "Return", "Var", "While",
+}
+
+func TestAstJSONRoundTrip(t *testing.T) {
+	reporter := NewReporter(io.Discard, "<test>", astSource)
+	statements, _ := NewParser(NewScanner(strings.NewReader(astSource), reporter), reporter).Parse()
+	if reporter.HadError() {
+		t.Fatal(reporter.Diagnostics())
+	}
+
+	encoded, err := MarshalAst(statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kinds := nodeKinds(t, encoded); !slices.Equal(kinds, slices.Sorted(slices.Values(astKinds))) {
+		t.Errorf("encoded kinds %v, want every kind %v", kinds, astKinds)
+	}
+
+	decoded, err := UnmarshalAst(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reencoded, err := MarshalAst(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, reencoded) {
+		t.Errorf("encoding again gave\n%s\nwant\n%s", reencoded, encoded)
+	}
+
+	printer := NewAstPrinter()
+	for idx := range statements {
+		if got, want := printer.PrintStmt(decoded[idx]), printer.PrintStmt(statements[idx]); got != want {
+			t.Errorf("statement %d decoded as %s, want %s", idx, got, want)
+		}
+	}
+}
+
+// nodeKinds returns the distinct node kinds in a JSON AST, sorted.
+func nodeKinds(t *testing.T, data []byte) []string {
+	var tree any
+	if err := json.Unmarshal(data, &tree); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := map[string]bool{}
+	var walk func(value any)
+	walk = func(value any) {
+		switch v := value.(type) {
+		case []any:
+			for _, element := range v {
+				walk(element)
+			}
+		case map[string]any:
+			if kind, ok := v["kind"].(string); ok {
+				kinds[kind] = true
+			}
+			for _, field := range v {
+				walk(field)
+			}
+		}
+	}
+	walk(tree)
+	return slices.Sorted(maps.Keys(kinds))
+}
+
+func TestAstJSONFloats(t *testing.T) {
+	for _, source := range []string{"2.0", "-0.0", "1e308 * 10", "-(1e308 * 10)", "1e308 * 10 - 1e308 * 10"} {
+		// Folded by the Optimizer, into infinities and NaN for the last three
+		script := "print " + source + ";"
+		l := NewLox(io.Discard, io.Discard)
+		reporter := NewReporter(io.Discard, "<test>", script)
+		statements, err := l.parse(reporter, strings.NewReader(script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr := statements[0].(*Print).Expression
+
+		encoded, err := MarshalExpr(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+		decoded, err := UnmarshalExpr(encoded)
+		if err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+		literal, ok := decoded.(*Literal)
+		if !ok {
+			t.Fatalf("%s decoded to %T, want a *Literal", source, decoded)
+		}
+		if got, want := l.interpreter.stringify(literal.Value), l.interpreter.stringify(expr.(*Literal).Value); got != want {
+			t.Errorf("%s decoded to %s, want %s", source, got, want)
+		}
+	}
+}
+
+func TestAstJSONRejects(t *testing.T) {
+	token := `{"type": "NUMBER", "lexeme": "1", "line": 1, "column": 1, "offset": 0}`
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"unknown statement kind", `[{"kind": "Loop", "body": null}]`},
+		{"expression as a statement", `[{"kind": "Literal", "type": "int", "value": 1, "token": ` + token + `}]`},
+		{"unknown expression kind", `[{"kind": "Print", "expression": {"kind": "Ternary"}}]`},
+		{"statement as an expression", `[{"kind": "Print", "expression": {"kind": "Print", "expression": null}}]`},
+		{"missing kind", `[{"expression": null}]`},
+		{"unknown literal type", `[{"kind": "Print", "expression": {"kind": "Literal", "type": "complex", "value": 1, "token": ` + token + `}}]`},
+		{"unknown token type", `[{"kind": "Var", "name": {"type": "KEYWORD", "lexeme": "x"}, "initializer": null}]`},
+		{"not JSON", `[{"kind": `},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := UnmarshalAst([]byte(test.json)); !errors.Is(err, ErrInvalidAst) {
+				t.Errorf("got error %v, want ErrInvalidAst", err)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package lox
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -18,25 +19,141 @@ func (ap *AstPrinter) Print(expr Expr) string {
 	return expr.Accept(ap).(string)
 }
 
+func (ap *AstPrinter) PrintStmt(stmt Stmt) string {
+	return stmt.Accept(ap).(string)
+}
+
+// Statements
+func (ap *AstPrinter) VisitBlockStmt(stmt *Block) interface{} {
+	var builder strings.Builder
+	builder.WriteString("(block")
+	for _, statement := range stmt.Statements {
+		builder.WriteString(" ")
+		builder.WriteString(statement.Accept(ap).(string))
+	}
+	builder.WriteString(")")
+	return builder.String()
+}
+
+func (ap *AstPrinter) VisitClassStmt(stmt *Class) interface{} {
+	var builder strings.Builder
+	builder.WriteString("(class " + stmt.Name.Lexeme)
+	if stmt.Superclass != nil {
+		builder.WriteString(" < " + stmt.Superclass.Name.Lexeme)
+	}
+	for _, method := range stmt.Methods {
+		builder.WriteString(" ")
+		builder.WriteString(method.Accept(ap).(string))
+	}
+	builder.WriteString(")")
+	return builder.String()
+}
+
+func (ap *AstPrinter) VisitExpressionStmt(stmt *Expression) interface{} {
+	return ap.parenthesize(";", stmt.Expression)
+}
+
+func (ap *AstPrinter) VisitFunctionStmt(stmt *Function) interface{} {
+	var builder strings.Builder
+	builder.WriteString("(fun " + stmt.Name.Lexeme + "(")
+	for idx, param := range stmt.Params {
+		if idx != 0 {
+			builder.WriteString(" ")
+		}
+		builder.WriteString(param.Lexeme)
+	}
+	builder.WriteString(")")
+	for _, statement := range stmt.Body {
+		builder.WriteString(" ")
+		builder.WriteString(statement.Accept(ap).(string))
+	}
+	builder.WriteString(")")
+	return builder.String()
+}
+
+func (ap *AstPrinter) VisitIfStmt(stmt *If) interface{} {
+	if stmt.ElseBranch == nil {
+		return fmt.Sprintf("(if %s %s)", ap.Print(stmt.Condition), ap.PrintStmt(stmt.ThenBranch))
+	}
+	return fmt.Sprintf(
+		"(if-else %s %s %s)",
+		ap.Print(stmt.Condition),
+		ap.PrintStmt(stmt.ThenBranch),
+		ap.PrintStmt(stmt.ElseBranch),
+	)
+}
+
+func (ap *AstPrinter) VisitPrintStmt(stmt *Print) interface{} {
+	return ap.parenthesize("print", stmt.Expression)
+}
+
+func (ap *AstPrinter) VisitReturnStmt(stmt *Return) interface{} {
+	if stmt.Value == nil {
+		return "(return)"
+	}
+	return ap.parenthesize("return", stmt.Value)
+}
+
+func (ap *AstPrinter) VisitVarStmt(stmt *Var) interface{} {
+	if stmt.Initializer == nil {
+		return ap.parenthesize("var " + stmt.Name.Lexeme)
+	}
+	return ap.parenthesize("var "+stmt.Name.Lexeme+" =", stmt.Initializer)
+}
+
+func (ap *AstPrinter) VisitWhileStmt(stmt *While) interface{} {
+	return fmt.Sprintf("(while %s %s)", ap.Print(stmt.Condition), ap.PrintStmt(stmt.Body))
+}
+
+// Expressions
+func (ap *AstPrinter) VisitAssignExpr(expr *Assign) interface{} {
+	return ap.parenthesize("= "+expr.Name.Lexeme, expr.Value)
+}
+
 func (ap *AstPrinter) VisitBinaryExpr(expr *Binary) interface{} {
 	return ap.parenthesize(expr.Operator.Lexeme, expr.Left, expr.Right)
 }
 
+func (ap *AstPrinter) VisitCallExpr(expr *Call) interface{} {
+	return ap.parenthesize("call", append([]Expr{expr.Callee}, expr.Arguments...)...)
+}
+
+func (ap *AstPrinter) VisitGetExpr(expr *Get) interface{} {
+	return ap.parenthesize(". "+expr.Name.Lexeme, expr.Object)
+}
+
 func (ap *AstPrinter) VisitGroupingExpr(expr *Grouping) interface{} {
 	return ap.parenthesize("group", expr.Expression)
 }
 
 func (ap *AstPrinter) VisitLiteralExpr(expr *Literal) interface{} {
-	if expr.Value == nil {
-		return "nil"
-	}
-	return fmt.Sprintf("%v", expr.Value)
+	return literalSource(expr.Value)
+}
+
+func (ap *AstPrinter) VisitLogicalExpr(expr *Logical) interface{} {
+	return ap.parenthesize(expr.Operator.Lexeme, expr.Left, expr.Right)
+}
+
+func (ap *AstPrinter) VisitSetExpr(expr *Set) interface{} {
+	return ap.parenthesize("= . "+expr.Name.Lexeme, expr.Object, expr.Value)
+}
+
+func (ap *AstPrinter) VisitSuperExpr(expr *Super) interface{} {
+	return "(super " + expr.Method.Lexeme + ")"
+}
+
+func (ap *AstPrinter) VisitThisExpr(expr *This) interface{} {
+	return "this"
 }
 
 func (ap *AstPrinter) VisitUnaryExpr(expr *Unary) interface{} {
 	return ap.parenthesize(expr.Operator.Lexeme, expr.Right)
 }
 
+func (ap *AstPrinter) VisitVariableExpr(expr *Variable) interface{} {
+	return expr.Name.Lexeme
+}
+
 func (ap *AstPrinter) parenthesize(name string, exprs ...Expr) string {
 	var builder strings.Builder
 	builder.WriteString("(")
@@ -50,3 +167,34 @@ func (ap *AstPrinter) parenthesize(name string, exprs ...Expr) string {
 	builder.WriteString(")")
 	return builder.String()
 }
+
+// literalSource writes a literal value the way it is written in source, so
+// "5", 5 and 5.0 stay apart.
+func literalSource(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return formatFloat(v)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// ExampleAst prints the hand-built tree for `-123 * (45.67)`.
+func ExampleAst() string {
+	expr := NewBinary(
+		NewUnary(
+			*NewToken(MINUS, "-", nil, 1, 1, 0),
+			NewLiteral(int64(123), *NewToken(NUMBER, "123", int64(123), 1, 2, 1), Span{Start: 1, End: 4, Line: 1, Column: 2}),
+		),
+		*NewToken(STAR, "*", nil, 1, 6, 5),
+		NewGrouping(
+			*NewToken(LEFT_PAREN, "(", nil, 1, 8, 7),
+			NewLiteral(45.67, *NewToken(NUMBER, "45.67", 45.67, 1, 9, 8), Span{Start: 8, End: 13, Line: 1, Column: 9}),
+			*NewToken(RIGHT_PAREN, ")", nil, 1, 14, 13),
+		),
+	)
+	return NewAstPrinter().Print(expr)
+}
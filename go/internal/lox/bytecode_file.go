@@ -0,0 +1,405 @@
+package lox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// A compiled .loxc file is a header followed by the top-level script
+// encoded as a function. All integers are little endian.
+//
+//	magic    "LOXC"
+//	version  uint16
+//	length   uint32  size of the payload in bytes
+//	checksum uint32  CRC-32 (IEEE) of the payload
+//	payload  function
+//
+// A function is its name, arity, upvalue count, code, line table and
+// constant pool. The line table keeps each run's full source span, not just
+// its line. Constants are tagged floats, strings, nested functions or ints.
+const (
+	bytecodeMagic   = "LOXC"
+	BytecodeVersion = 4
+
+	bytecodeHeaderSize = len(bytecodeMagic) + 2 + 4 + 4
+)
+
+const (
+	constantNumber byte = iota
+	constantString
+	constantFunction
+	constantInt
+)
+
+// ErrInvalidBytecode is wrapped by every error from loading a .loxc file
+// that is truncated, corrupted or from an unsupported version.
+var ErrInvalidBytecode = errors.New("invalid compiled bytecode")
+
+// WriteBytecode encodes function, normally a compiled script, to w.
+func WriteBytecode(w io.Writer, function *ObjFunction) error {
+	var payload bytes.Buffer
+	if err := writeFunction(&payload, function); err != nil {
+		return err
+	}
+
+	header := make([]byte, 0, bytecodeHeaderSize)
+	header = append(header, bytecodeMagic...)
+	header = binary.LittleEndian.AppendUint16(header, BytecodeVersion)
+	header = binary.LittleEndian.AppendUint32(header, uint32(payload.Len()))
+	header = binary.LittleEndian.AppendUint32(header, crc32.ChecksumIEEE(payload.Bytes()))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload.Bytes())
+	return err
+}
+
+func writeFunction(w *bytes.Buffer, function *ObjFunction) error {
+	name := ""
+	if function.Name != nil {
+		name = function.Name.Chars
+	}
+	writeString(w, name)
+	w.WriteByte(byte(function.Arity))
+	w.WriteByte(byte(function.UpvalueCount))
+
+	chunk := function.Chunk
+	writeUint32(w, len(chunk.Code))
+	w.Write(chunk.Code)
+
+	writeUint32(w, len(chunk.Lines))
+	for _, line := range chunk.Lines {
+		writeUint32(w, line.Offset)
+		writeUint32(w, line.Start)
+		writeUint32(w, line.End)
+		writeUint32(w, line.Line)
+		writeUint32(w, line.Column)
+	}
+
+	writeUint32(w, len(chunk.Constants))
+	for _, constant := range chunk.Constants {
+		switch {
+		case constant.Type == VAL_INT:
+			w.WriteByte(constantInt)
+			w.Write(binary.LittleEndian.AppendUint64(nil, uint64(constant.integer)))
+		case constant.Type == VAL_NUMBER:
+			w.WriteByte(constantNumber)
+			w.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(constant.number)))
+		case constant.Type == VAL_OBJ:
+			switch obj := constant.obj.(type) {
+			case *ObjString:
+				w.WriteByte(constantString)
+				writeString(w, obj.Chars)
+			case *ObjFunction:
+				w.WriteByte(constantFunction)
+				if err := writeFunction(w, obj); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("cannot serialize constant %s", constant)
+			}
+		default:
+			return fmt.Errorf("cannot serialize constant %s", constant)
+		}
+	}
+	return nil
+}
+
+func writeUint32(w *bytes.Buffer, n int) {
+	w.Write(binary.LittleEndian.AppendUint32(nil, uint32(n)))
+}
+
+func writeString(w *bytes.Buffer, s string) {
+	writeUint32(w, len(s))
+	w.WriteString(s)
+}
+
+// ReadBytecode decodes a script written by WriteBytecode, interning its
+// strings in the VM that will run it. The header, checksum and every
+// instruction's operands are validated so a bad file is rejected here
+// rather than crashing the VM.
+func (vm *VM) ReadBytecode(data []byte) (*ObjFunction, error) {
+	if len(data) < bytecodeHeaderSize {
+		return nil, fmt.Errorf("%w: file is too short for a header", ErrInvalidBytecode)
+	}
+	if string(data[:len(bytecodeMagic)]) != bytecodeMagic {
+		return nil, fmt.Errorf("%w: not a compiled Lox file", ErrInvalidBytecode)
+	}
+
+	header := data[len(bytecodeMagic):bytecodeHeaderSize]
+	version := binary.LittleEndian.Uint16(header)
+	length := binary.LittleEndian.Uint32(header[2:])
+	checksum := binary.LittleEndian.Uint32(header[6:])
+	if version != BytecodeVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d, want %d", ErrInvalidBytecode, version, BytecodeVersion)
+	}
+
+	payload := data[bytecodeHeaderSize:]
+	if uint64(len(payload)) != uint64(length) {
+		return nil, fmt.Errorf("%w: payload is %d bytes, header says %d", ErrInvalidBytecode, len(payload), length)
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidBytecode)
+	}
+
+	reader := &bytecodeReader{vm: vm, data: payload}
+	function, err := reader.readFunction()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidBytecode, err)
+	}
+	if reader.offset != len(payload) {
+		return nil, fmt.Errorf("%w: trailing data after script", ErrInvalidBytecode)
+	}
+	return function, nil
+}
+
+type bytecodeReader struct {
+	vm     *VM
+	data   []byte
+	offset int
+}
+
+var errTruncated = errors.New("unexpected end of file")
+
+func (r *bytecodeReader) readBytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.offset {
+		return nil, errTruncated
+	}
+	b := r.data[r.offset : r.offset+n]
+	r.offset += n
+	return b, nil
+}
+
+func (r *bytecodeReader) readByte() (byte, error) {
+	b, err := r.readBytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *bytecodeReader) readUint32() (int, error) {
+	b, err := r.readBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.LittleEndian.Uint32(b)), nil
+}
+
+func (r *bytecodeReader) readString() (string, error) {
+	length, err := r.readUint32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.readBytes(length)
+	return string(b), err
+}
+
+func (r *bytecodeReader) readFunction() (*ObjFunction, error) {
+	// Loaded objects aren't reachable yet, keep them from being collected
+	function := r.vm.newFunction()
+	r.vm.push(objValue(function))
+	defer r.vm.pop()
+
+	name, err := r.readString()
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		function.Name = r.vm.copyString(name)
+	}
+
+	arity, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	upvalueCount, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	function.Arity = int(arity)
+	function.UpvalueCount = int(upvalueCount)
+
+	chunk := function.Chunk
+	codeLength, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	code, err := r.readBytes(codeLength)
+	if err != nil {
+		return nil, err
+	}
+	chunk.Code = append(chunk.Code, code...)
+
+	lineCount, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	for range lineCount {
+		var fields [5]int
+		for idx := range fields {
+			if fields[idx], err = r.readUint32(); err != nil {
+				return nil, err
+			}
+		}
+		span := Span{Start: fields[1], End: fields[2], Line: fields[3], Column: fields[4]}
+		chunk.Lines = append(chunk.Lines, LineStart{Offset: fields[0], Span: span})
+	}
+
+	constantCount, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	if constantCount > maxLongOperand+1 {
+		return nil, fmt.Errorf("%s has %d constants", function, constantCount)
+	}
+	for range constantCount {
+		constant, err := r.readConstant()
+		if err != nil {
+			return nil, err
+		}
+		chunk.Constants = append(chunk.Constants, constant)
+	}
+
+	if err := verifyFunction(function); err != nil {
+		return nil, fmt.Errorf("%s: %s", function, err)
+	}
+	return function, nil
+}
+
+func (r *bytecodeReader) readConstant() (Value, error) {
+	tag, err := r.readByte()
+	if err != nil {
+		return nilValue(), err
+	}
+
+	switch tag {
+	case constantNumber:
+		b, err := r.readBytes(8)
+		if err != nil {
+			return nilValue(), err
+		}
+		return numberValue(math.Float64frombits(binary.LittleEndian.Uint64(b))), nil
+	case constantInt:
+		b, err := r.readBytes(8)
+		if err != nil {
+			return nilValue(), err
+		}
+		return intValue(int64(binary.LittleEndian.Uint64(b))), nil
+	case constantString:
+		s, err := r.readString()
+		if err != nil {
+			return nilValue(), err
+		}
+		return objValue(r.vm.copyString(s)), nil
+	case constantFunction:
+		function, err := r.readFunction()
+		if err != nil {
+			return nilValue(), err
+		}
+		return objValue(function), nil
+	}
+	return nilValue(), fmt.Errorf("unknown constant tag %d", tag)
+}
+
+// verifyFunction checks that every instruction is known, complete, and
+// only refers to constants, upvalues and jump targets that exist.
+func verifyFunction(function *ObjFunction) error {
+	chunk := function.Chunk
+	code := chunk.Code
+	if len(code) == 0 || OpCode(code[len(code)-1]) != OP_RETURN {
+		return errors.New("code does not end in a return")
+	}
+
+	// constant checks the constant operand of the instruction at offset
+	constant := func(offset int) (Value, error) {
+		op := OpCode(code[offset])
+		if offset+op.constantWidth() >= len(code) {
+			return nilValue(), fmt.Errorf("instruction at %d is truncated", offset)
+		}
+		index, _ := constantOperand(op, chunk, offset)
+		if index >= len(chunk.Constants) {
+			return nilValue(), fmt.Errorf("instruction at %d refers to missing constant %d", offset, index)
+		}
+		return chunk.Constants[index], nil
+	}
+
+	for offset := 0; offset < len(code); {
+		op := OpCode(code[offset])
+		switch op {
+		case OP_CONSTANT, OP_CONSTANT_LONG:
+			if _, err := constant(offset); err != nil {
+				return err
+			}
+			offset += 1 + op.constantWidth()
+		case OP_GET_GLOBAL, OP_DEFINE_GLOBAL, OP_SET_GLOBAL, OP_GET_PROPERTY,
+			OP_SET_PROPERTY, OP_GET_SUPER, OP_CLASS, OP_METHOD, OP_INVOKE, OP_SUPER_INVOKE,
+			OP_GET_GLOBAL_LONG, OP_DEFINE_GLOBAL_LONG, OP_SET_GLOBAL_LONG, OP_GET_PROPERTY_LONG,
+			OP_SET_PROPERTY_LONG, OP_GET_SUPER_LONG, OP_CLASS_LONG, OP_METHOD_LONG,
+			OP_INVOKE_LONG, OP_SUPER_INVOKE_LONG:
+			value, err := constant(offset)
+			if err != nil {
+				return err
+			}
+			if _, ok := value.asString(); !ok {
+				return fmt.Errorf("%s at %d needs a string constant", op, offset)
+			}
+			offset += 1 + op.constantWidth()
+			switch op {
+			case OP_INVOKE, OP_SUPER_INVOKE, OP_INVOKE_LONG, OP_SUPER_INVOKE_LONG:
+				offset++
+			}
+		case OP_GET_LOCAL, OP_SET_LOCAL, OP_CALL:
+			offset += 2
+		case OP_GET_UPVALUE, OP_SET_UPVALUE:
+			if offset+1 < len(code) && int(code[offset+1]) >= function.UpvalueCount {
+				return fmt.Errorf("%s at %d refers to missing upvalue %d", op, offset, code[offset+1])
+			}
+			offset += 2
+		case OP_JUMP, OP_JUMP_IF_FALSE, OP_LOOP:
+			if offset+2 >= len(code) {
+				return fmt.Errorf("instruction at %d is truncated", offset)
+			}
+			jump := int(code[offset+1])<<8 | int(code[offset+2])
+			target := offset + 3 + jump
+			if op == OP_LOOP {
+				target = offset + 3 - jump
+			}
+			if target < 0 || target >= len(code) {
+				return fmt.Errorf("%s at %d jumps outside the code", op, offset)
+			}
+			offset += 3
+		case OP_CLOSURE, OP_CLOSURE_LONG:
+			value, err := constant(offset)
+			if err != nil {
+				return err
+			}
+			nested, ok := value.obj.(*ObjFunction)
+			if !ok {
+				return fmt.Errorf("%s at %d needs a function constant", op, offset)
+			}
+			offset += 1 + op.constantWidth()
+			for range nested.UpvalueCount {
+				if offset+1 < len(code) && code[offset] != 1 && int(code[offset+1]) >= function.UpvalueCount {
+					return fmt.Errorf("%s at %d captures missing upvalue %d", op, offset, code[offset+1])
+				}
+				offset += 2
+			}
+		default:
+			if int(op) >= len(opNames) {
+				return fmt.Errorf("unknown opcode %d at %d", op, offset)
+			}
+			offset++
+		}
+		if offset > len(code) {
+			return errors.New("last instruction is truncated")
+		}
+	}
+	return nil
+}
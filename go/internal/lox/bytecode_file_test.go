@@ -0,0 +1,179 @@
+package lox
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+)
+
+const bytecodeScript = `
+var greeting = "hi";
+fun counter() {
+  var count = 0;
+  fun increment() {
+    count = count + 1;
+    return count;
+  }
+  return increment;
+}
+class A { name() { return "A"; } }
+class B < A { name() { return "B" + super.name(); } }
+var next = counter();
+next();
+print next();
+print B().name();
+print greeting;
+`
+
+// bytecodeSource is bytecodeScript followed by enough constants for the
+// long instructions.
+func bytecodeSource() string {
+	var builder strings.Builder
+	builder.WriteString(bytecodeScript)
+	for idx := range 300 {
+		fmt.Fprintf(&builder, "var g%d = %d.5;\n", idx, idx)
+	}
+	builder.WriteString("print g299 + 1;\n")
+	return builder.String()
+}
+
+func compileScript(t testing.TB, source string) *ObjFunction {
+	t.Helper()
+	l := NewLox(io.Discard, io.Discard)
+	reporter := NewStreamReporter(io.Discard, "<test>")
+	statements, err := l.parse(reporter, reporter.Source(strings.NewReader(source)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	function, err := l.compile(reporter, statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return function
+}
+
+func writeBytecode(t testing.TB, function *ObjFunction) []byte {
+	t.Helper()
+	var file bytes.Buffer
+	if err := WriteBytecode(&file, function); err != nil {
+		t.Fatal(err)
+	}
+	return file.Bytes()
+}
+
+// sealBytecode puts a valid header in front of payload.
+func sealBytecode(payload []byte) []byte {
+	file := []byte(bytecodeMagic)
+	file = binary.LittleEndian.AppendUint16(file, BytecodeVersion)
+	file = binary.LittleEndian.AppendUint32(file, uint32(len(payload)))
+	file = binary.LittleEndian.AppendUint32(file, crc32.ChecksumIEEE(payload))
+	return append(file, payload...)
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	file := writeBytecode(t, compileScript(t, bytecodeSource()))
+
+	var stdout strings.Builder
+	vm := NewVM(&stdout)
+	function, err := vm.ReadBytecode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again := writeBytecode(t, function); !bytes.Equal(again, file) {
+		t.Error("writing the script read back changed the file")
+	}
+
+	if _, err := vm.Interpret(context.Background(), function); err != nil {
+		t.Fatal(err)
+	}
+	if want := "2\nBA\nhi\n300.5\n"; stdout.String() != want {
+		t.Errorf("printed %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestReadBytecodeRejects(t *testing.T) {
+	valid := writeBytecode(t, compileScript(t, bytecodeSource()))
+	payload := valid[bytecodeHeaderSize:]
+
+	// script builds a file holding a single function
+	script := func(code []byte, upvalueCount int, constants ...Value) []byte {
+		chunk := NewChunk()
+		chunk.Code = code
+		chunk.Constants = constants
+		return writeBytecode(t, &ObjFunction{UpvalueCount: upvalueCount, Chunk: chunk})
+	}
+	str := objValue(&ObjString{Chars: "x"})
+	// No constants, then one with an unknown tag
+	noConstants := script(nil, 0)
+	badTag := sealBytecode(append(bytes.Clone(noConstants[bytecodeHeaderSize:len(noConstants)-4]), 1, 0, 0, 0, 0xff))
+	badVersion := bytes.Clone(valid)
+	binary.LittleEndian.PutUint16(badVersion[len(bytecodeMagic):], BytecodeVersion+1)
+	capturing := &ObjFunction{UpvalueCount: 1, Chunk: &Chunk{Code: []byte{byte(OP_NIL), byte(OP_RETURN)}}}
+
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{"empty", nil},
+		{"truncated header", valid[:bytecodeHeaderSize-1]},
+		{"truncated payload", valid[:len(valid)-1]},
+		{"truncated payload with valid header", sealBytecode(payload[:len(payload)/2])},
+		{"trailing data", sealBytecode(append(bytes.Clone(payload), 0))},
+		{"flipped checksum", flipByte(valid, bytecodeHeaderSize-1)},
+		{"flipped payload", flipByte(valid, len(valid)-1)},
+		{"bad magic", flipByte(valid, 0)},
+		{"bad version", badVersion},
+		{"no return", script([]byte{byte(OP_NIL)}, 0)},
+		{"unknown opcode", script([]byte{0xff, byte(OP_RETURN)}, 0)},
+		{"unknown constant tag", badTag},
+		{"missing constant", script([]byte{byte(OP_CONSTANT), 1, byte(OP_RETURN)}, 0, intValue(1))},
+		{"missing long constant", script([]byte{byte(OP_CONSTANT_LONG), 1, 0, 0, byte(OP_RETURN)}, 0, intValue(1))},
+		{"truncated constant", script([]byte{byte(OP_CONSTANT_LONG), 0, byte(OP_RETURN)}, 0, intValue(1))},
+		{"global name not a string", script([]byte{byte(OP_GET_GLOBAL), 0, byte(OP_RETURN)}, 0, intValue(1))},
+		{"closure of a string", script([]byte{byte(OP_CLOSURE), 0, byte(OP_RETURN)}, 0, str)},
+		{"jump past the end", script([]byte{byte(OP_JUMP), 0, 9, byte(OP_RETURN)}, 0)},
+		{"loop before the start", script([]byte{byte(OP_LOOP), 0, 9, byte(OP_RETURN)}, 0)},
+		{"truncated jump", script([]byte{byte(OP_JUMP), byte(OP_RETURN)}, 0)},
+		{"missing upvalue", script([]byte{byte(OP_GET_UPVALUE), 0, byte(OP_RETURN)}, 0)},
+		{"missing set upvalue", script([]byte{byte(OP_SET_UPVALUE), 2, byte(OP_RETURN)}, 1)},
+		{"captures missing upvalue", script([]byte{byte(OP_CLOSURE), 0, 0, 3, byte(OP_RETURN)}, 0, objValue(capturing))},
+		{"truncated closure", script([]byte{byte(OP_CLOSURE), 0, byte(OP_RETURN)}, 0, objValue(capturing))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewVM(io.Discard).ReadBytecode(test.file)
+			if !errors.Is(err, ErrInvalidBytecode) {
+				t.Errorf("got error %v, want ErrInvalidBytecode", err)
+			}
+		})
+	}
+}
+
+func flipByte(file []byte, offset int) []byte {
+	file = bytes.Clone(file)
+	file[offset] ^= 0xff
+	return file
+}
+
+func FuzzReadBytecode(f *testing.F) {
+	valid := writeBytecode(f, compileScript(f, bytecodeScript))
+	f.Add(valid)
+	f.Add(valid[bytecodeHeaderSize:])
+	f.Add([]byte(bytecodeMagic))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Sealed too, as a payload, so mutations get past the checksum
+		for _, file := range [][]byte{data, sealBytecode(data)} {
+			if _, err := NewVM(io.Discard).ReadBytecode(file); err != nil && !errors.Is(err, ErrInvalidBytecode) {
+				t.Errorf("got error %v, want ErrInvalidBytecode", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package lox
+
+// LoxCallable is any runtime value that can be invoked with call syntax.
+type LoxCallable interface {
+	Arity() int
+	Call(interpreter *Interpreter, arguments []any) any
+}
+
+type LoxFunction struct {
+	declaration   *Function
+	closure       *Environment
+	isInitializer bool
+}
+
+func NewLoxFunction(declaration *Function, closure *Environment, isInitializer bool) *LoxFunction {
+	return &LoxFunction{
+		declaration:   declaration,
+		closure:       closure,
+		isInitializer: isInitializer,
+	}
+}
+
+// Bind returns a copy of the method whose closure defines "this" as instance.
+func (f *LoxFunction) Bind(instance *LoxInstance) *LoxFunction {
+	environment := NewEnclosedEnvironment(f.closure)
+	environment.Define("this", instance)
+	return NewLoxFunction(f.declaration, environment, f.isInitializer)
+}
+
+func (f *LoxFunction) Arity() int {
+	return len(f.declaration.Params)
+}
+
+func (f *LoxFunction) Call(interpreter *Interpreter, arguments []any) any {
+	environment := NewEnclosedEnvironment(f.closure)
+	for idx, param := range f.declaration.Params {
+		environment.Define(param.Lexeme, arguments[idx])
+	}
+
+	ret, ok := interpreter.executeBlock(f.declaration.Body, environment).(*returnValue)
+
+	// Initializers always hand back the instance, even on a bare return
+	if f.isInitializer {
+		return f.closure.GetAt(0, "this")
+	}
+	if ok {
+		return ret.value
+	}
+	return nil
+}
+
+func (f *LoxFunction) String() string {
+	return "<fn " + f.declaration.Name.Lexeme + ">"
+}
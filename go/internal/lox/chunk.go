@@ -0,0 +1,232 @@
+package lox
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type OpCode byte
+
+const (
+	OP_CONSTANT OpCode = iota
+	OP_CONSTANT_LONG
+	OP_NIL
+	OP_TRUE
+	OP_FALSE
+	OP_POP
+	OP_GET_LOCAL
+	OP_SET_LOCAL
+	OP_GET_GLOBAL
+	OP_GET_GLOBAL_LONG
+	OP_DEFINE_GLOBAL
+	OP_DEFINE_GLOBAL_LONG
+	OP_SET_GLOBAL
+	OP_SET_GLOBAL_LONG
+	OP_GET_UPVALUE
+	OP_SET_UPVALUE
+	OP_GET_PROPERTY
+	OP_GET_PROPERTY_LONG
+	OP_SET_PROPERTY
+	OP_SET_PROPERTY_LONG
+	OP_GET_SUPER
+	OP_GET_SUPER_LONG
+	OP_EQUAL
+	OP_GREATER
+	OP_LESS
+	OP_ADD
+	OP_SUBTRACT
+	OP_MULTIPLY
+	OP_DIVIDE
+	OP_MODULO
+	OP_NOT
+	OP_NEGATE
+	OP_PRINT
+	OP_JUMP
+	OP_JUMP_IF_FALSE
+	OP_LOOP
+	OP_CALL
+	OP_INVOKE
+	OP_INVOKE_LONG
+	OP_SUPER_INVOKE
+	OP_SUPER_INVOKE_LONG
+	OP_CLOSURE
+	OP_CLOSURE_LONG
+	OP_CLOSE_UPVALUE
+	OP_RETURN
+	OP_CLASS
+	OP_CLASS_LONG
+	OP_INHERIT
+	OP_METHOD
+	OP_METHOD_LONG
+)
+
+var opNames = [...]string{
+	OP_CONSTANT:           "OP_CONSTANT",
+	OP_CONSTANT_LONG:      "OP_CONSTANT_LONG",
+	OP_NIL:                "OP_NIL",
+	OP_TRUE:               "OP_TRUE",
+	OP_FALSE:              "OP_FALSE",
+	OP_POP:                "OP_POP",
+	OP_GET_LOCAL:          "OP_GET_LOCAL",
+	OP_SET_LOCAL:          "OP_SET_LOCAL",
+	OP_GET_GLOBAL:         "OP_GET_GLOBAL",
+	OP_GET_GLOBAL_LONG:    "OP_GET_GLOBAL_LONG",
+	OP_DEFINE_GLOBAL:      "OP_DEFINE_GLOBAL",
+	OP_DEFINE_GLOBAL_LONG: "OP_DEFINE_GLOBAL_LONG",
+	OP_SET_GLOBAL:         "OP_SET_GLOBAL",
+	OP_SET_GLOBAL_LONG:    "OP_SET_GLOBAL_LONG",
+	OP_GET_UPVALUE:        "OP_GET_UPVALUE",
+	OP_SET_UPVALUE:        "OP_SET_UPVALUE",
+	OP_GET_PROPERTY:       "OP_GET_PROPERTY",
+	OP_GET_PROPERTY_LONG:  "OP_GET_PROPERTY_LONG",
+	OP_SET_PROPERTY:       "OP_SET_PROPERTY",
+	OP_SET_PROPERTY_LONG:  "OP_SET_PROPERTY_LONG",
+	OP_GET_SUPER:          "OP_GET_SUPER",
+	OP_GET_SUPER_LONG:     "OP_GET_SUPER_LONG",
+	OP_EQUAL:              "OP_EQUAL",
+	OP_GREATER:            "OP_GREATER",
+	OP_LESS:               "OP_LESS",
+	OP_ADD:                "OP_ADD",
+	OP_SUBTRACT:           "OP_SUBTRACT",
+	OP_MULTIPLY:           "OP_MULTIPLY",
+	OP_DIVIDE:             "OP_DIVIDE",
+	OP_MODULO:             "OP_MODULO",
+	OP_NOT:                "OP_NOT",
+	OP_NEGATE:             "OP_NEGATE",
+	OP_PRINT:              "OP_PRINT",
+	OP_JUMP:               "OP_JUMP",
+	OP_JUMP_IF_FALSE:      "OP_JUMP_IF_FALSE",
+	OP_LOOP:               "OP_LOOP",
+	OP_CALL:               "OP_CALL",
+	OP_INVOKE:             "OP_INVOKE",
+	OP_INVOKE_LONG:        "OP_INVOKE_LONG",
+	OP_SUPER_INVOKE:       "OP_SUPER_INVOKE",
+	OP_SUPER_INVOKE_LONG:  "OP_SUPER_INVOKE_LONG",
+	OP_CLOSURE:            "OP_CLOSURE",
+	OP_CLOSURE_LONG:       "OP_CLOSURE_LONG",
+	OP_CLOSE_UPVALUE:      "OP_CLOSE_UPVALUE",
+	OP_RETURN:             "OP_RETURN",
+	OP_CLASS:              "OP_CLASS",
+	OP_CLASS_LONG:         "OP_CLASS_LONG",
+	OP_INHERIT:            "OP_INHERIT",
+	OP_METHOD:             "OP_METHOD",
+	OP_METHOD_LONG:        "OP_METHOD_LONG",
+}
+
+// longForms maps each instruction whose operand indexes the constant pool
+// to its long form, which takes a three byte index, most significant first,
+// for chunks with more than 256 constants.
+var longForms = map[OpCode]OpCode{
+	OP_CONSTANT:      OP_CONSTANT_LONG,
+	OP_GET_GLOBAL:    OP_GET_GLOBAL_LONG,
+	OP_DEFINE_GLOBAL: OP_DEFINE_GLOBAL_LONG,
+	OP_SET_GLOBAL:    OP_SET_GLOBAL_LONG,
+	OP_GET_PROPERTY:  OP_GET_PROPERTY_LONG,
+	OP_SET_PROPERTY:  OP_SET_PROPERTY_LONG,
+	OP_GET_SUPER:     OP_GET_SUPER_LONG,
+	OP_INVOKE:        OP_INVOKE_LONG,
+	OP_SUPER_INVOKE:  OP_SUPER_INVOKE_LONG,
+	OP_CLOSURE:       OP_CLOSURE_LONG,
+	OP_CLASS:         OP_CLASS_LONG,
+	OP_METHOD:        OP_METHOD_LONG,
+}
+
+func (op OpCode) isLong() bool {
+	switch op {
+	case OP_CONSTANT_LONG, OP_GET_GLOBAL_LONG, OP_DEFINE_GLOBAL_LONG, OP_SET_GLOBAL_LONG,
+		OP_GET_PROPERTY_LONG, OP_SET_PROPERTY_LONG, OP_GET_SUPER_LONG, OP_INVOKE_LONG,
+		OP_SUPER_INVOKE_LONG, OP_CLOSURE_LONG, OP_CLASS_LONG, OP_METHOD_LONG:
+		return true
+	}
+	return false
+}
+
+// constantWidth is how many bytes op's constant index takes.
+func (op OpCode) constantWidth() int {
+	if op.isLong() {
+		return 3
+	}
+	return 1
+}
+
+func (op OpCode) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return fmt.Sprintf("OP_UNKNOWN(%d)", byte(op))
+}
+
+// Chunk is a sequence of bytecode with the constants it refers to.
+type Chunk struct {
+	Code      []byte
+	Constants []Value
+	// Lines is run-length encoded, each entry holds from its offset until
+	// the next entry's.
+	Lines []LineStart
+}
+
+// LineStart records the source span of the code from Offset on, so runtime
+// errors can point at the same text the Interpreter's do.
+type LineStart struct {
+	Offset int
+	Span
+}
+
+func NewChunk() *Chunk {
+	return &Chunk{
+		Code:      []byte{},
+		Constants: []Value{},
+		Lines:     []LineStart{},
+	}
+}
+
+func (c *Chunk) Write(b byte, span Span) {
+	if len(c.Lines) == 0 || c.Lines[len(c.Lines)-1].Span != span {
+		c.Lines = append(c.Lines, LineStart{Offset: len(c.Code), Span: span})
+	}
+	c.Code = append(c.Code, b)
+}
+
+// AddConstant returns the index of value in the constant pool, reusing an
+// existing entry for equal numbers and strings. 1 and 1.0 are kept apart,
+// and so are -0.0 and 0.0.
+func (c *Chunk) AddConstant(value Value) int {
+	if _, isString := value.asString(); isString || value.isNumber() {
+		for idx, constant := range c.Constants {
+			if sameConstant(constant, value) {
+				return idx
+			}
+		}
+	}
+	c.Constants = append(c.Constants, value)
+	return len(c.Constants) - 1
+}
+
+// sameConstant reports whether two constants are interchangeable. Floats
+// compare by their bits so -0.0 and 0.0 stay apart.
+func sameConstant(a, b Value) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	if a.Type == VAL_NUMBER {
+		return math.Float64bits(a.number) == math.Float64bits(b.number)
+	}
+	return valuesEqual(a, b)
+}
+
+// Line returns the source line of the instruction at offset.
+func (c *Chunk) Line(offset int) int {
+	return c.Span(offset).Line
+}
+
+// Span returns the source span of the byte at offset.
+func (c *Chunk) Span(offset int) Span {
+	idx := sort.Search(len(c.Lines), func(i int) bool {
+		return c.Lines[i].Offset > offset
+	})
+	if idx == 0 {
+		return Span{}
+	}
+	return c.Lines[idx-1].Span
+}
@@ -0,0 +1,80 @@
+package lox
+
+type LoxClass struct {
+	name       string
+	superclass *LoxClass
+	methods    map[string]*LoxFunction
+}
+
+func NewLoxClass(name string, superclass *LoxClass, methods map[string]*LoxFunction) *LoxClass {
+	return &LoxClass{
+		name:       name,
+		superclass: superclass,
+		methods:    methods,
+	}
+}
+
+// FindMethod walks up the superclass chain until a class defines name.
+func (c *LoxClass) FindMethod(name string) *LoxFunction {
+	if method, ok := c.methods[name]; ok {
+		return method
+	}
+	if c.superclass != nil {
+		return c.superclass.FindMethod(name)
+	}
+	return nil
+}
+
+// Arity of a class is the arity of its initializer, if it has one.
+func (c *LoxClass) Arity() int {
+	if initializer := c.FindMethod("init"); initializer != nil {
+		return initializer.Arity()
+	}
+	return 0
+}
+
+func (c *LoxClass) Call(interpreter *Interpreter, arguments []any) any {
+	instance := NewLoxInstance(c)
+	if initializer := c.FindMethod("init"); initializer != nil {
+		initializer.Bind(instance).Call(interpreter, arguments)
+	}
+	return instance
+}
+
+func (c *LoxClass) String() string {
+	return c.name
+}
+
+type LoxInstance struct {
+	class  *LoxClass
+	fields map[string]any
+}
+
+func NewLoxInstance(class *LoxClass) *LoxInstance {
+	return &LoxInstance{
+		class:  class,
+		fields: make(map[string]any),
+	}
+}
+
+// Get looks up fields first so they shadow methods of the same name.
+func (i *LoxInstance) Get(name Token) any {
+	if value, ok := i.fields[name.Lexeme]; ok {
+		return value
+	}
+	if method := i.class.FindMethod(name.Lexeme); method != nil {
+		return method.Bind(i)
+	}
+	panic(&RuntimeError{
+		Token:   &name,
+		Message: "Undefined property '" + name.Lexeme + "'.",
+	})
+}
+
+func (i *LoxInstance) Set(name Token, value any) {
+	i.fields[name.Lexeme] = value
+}
+
+func (i *LoxInstance) String() string {
+	return i.class.name + " instance"
+}
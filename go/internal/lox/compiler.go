@@ -0,0 +1,722 @@
+package lox
+
+import "math"
+
+// Operands that index locals and upvalues are a single byte, and so are
+// constant indexes outside the long instructions.
+const maxByteOperand = math.MaxUint8
+
+// maxLongOperand bounds the three byte operand of the long instructions,
+// and so the constants in one chunk.
+const maxLongOperand = 1<<24 - 1
+
+// local is a variable living in a stack slot of the function being compiled.
+type local struct {
+	name       string
+	depth      int
+	isCaptured bool
+}
+
+// upvalueRef tells OP_CLOSURE where to find a captured variable, either a
+// local slot of the enclosing function or one of its own upvalues.
+type upvalueRef struct {
+	index   byte
+	isLocal bool
+}
+
+// functionCompiler holds the state of one function body being compiled.
+type functionCompiler struct {
+	enclosing    *functionCompiler
+	function     *ObjFunction
+	functionType FunctionType
+	locals       []local
+	upvalues     []upvalueRef
+	scopeDepth   int
+}
+
+type classCompiler struct {
+	enclosing     *classCompiler
+	hasSuperclass bool
+}
+
+// Compiler lowers a resolved AST to bytecode for the VM. It relies on the
+// Resolver having reported scope errors already and only reports limits
+// of the bytecode format itself.
+type Compiler struct {
+	vm           *VM
+	reporter     *Reporter
+	current      *functionCompiler
+	currentClass *classCompiler
+
+	// token is the last token visited, used for errors
+	token Token
+	// span is where emitted code comes from, which runtime errors point at
+	span Span
+}
+
+func NewCompiler(vm *VM, reporter *Reporter) *Compiler {
+	return &Compiler{
+		vm:       vm,
+		reporter: reporter,
+	}
+}
+
+// Compile returns the top-level script as a function. When the last
+// statement is an expression statement, the script returns its value.
+func (c *Compiler) Compile(statements []Stmt) *ObjFunction {
+	// Functions being compiled are roots until the VM takes over
+	c.vm.compiler = c
+	defer func() {
+		c.vm.compiler = nil
+	}()
+
+	c.beginFunction(FUNCTION_NONE, nil)
+
+	for idx, statement := range statements {
+		if expression, ok := statement.(*Expression); ok && idx == len(statements)-1 {
+			c.expression(expression.Expression)
+			c.emitOp(OP_RETURN)
+			return c.endFunction()
+		}
+		c.statement(statement)
+	}
+
+	c.emitReturn()
+	return c.endFunction()
+}
+
+// Statements
+func (c *Compiler) VisitBlockStmt(stmt *Block) interface{} {
+	c.beginScope()
+	for _, statement := range stmt.Statements {
+		c.statement(statement)
+	}
+	c.endScope()
+	return nil
+}
+
+func (c *Compiler) VisitClassStmt(stmt *Class) interface{} {
+	c.mark(stmt.Name)
+	nameConstant := c.identifierConstant(stmt.Name.Lexeme)
+	c.declareVariable(stmt.Name)
+
+	c.emitIndexed(OP_CLASS, nameConstant)
+	c.defineVariable(nameConstant)
+
+	class := &classCompiler{enclosing: c.currentClass}
+	c.currentClass = class
+
+	if stmt.Superclass != nil {
+		c.VisitVariableExpr(stmt.Superclass)
+
+		// Methods capture the superclass through this hidden local
+		c.beginScope()
+		c.addLocal("super")
+		c.defineVariable(0)
+
+		c.namedVariable(stmt.Name.Lexeme, false)
+		c.mark(stmt.Superclass.Name)
+		c.emitOp(OP_INHERIT)
+		class.hasSuperclass = true
+	}
+
+	c.namedVariable(stmt.Name.Lexeme, false)
+	for _, method := range stmt.Methods {
+		functionType := FUNCTION_METHOD
+		if method.Name.Lexeme == "init" {
+			functionType = FUNCTION_INITIALIZER
+		}
+		c.function(method, functionType)
+		c.emitIndexed(OP_METHOD, c.identifierConstant(method.Name.Lexeme))
+	}
+	c.emitOp(OP_POP)
+
+	if class.hasSuperclass {
+		c.endScope()
+	}
+	c.currentClass = class.enclosing
+	return nil
+}
+
+func (c *Compiler) VisitExpressionStmt(stmt *Expression) interface{} {
+	c.expression(stmt.Expression)
+	c.emitOp(OP_POP)
+	return nil
+}
+
+func (c *Compiler) VisitFunctionStmt(stmt *Function) interface{} {
+	c.mark(stmt.Name)
+	global := c.parseVariable(stmt.Name)
+
+	// Initialize right away so the body can refer to itself
+	c.markInitialized()
+	c.function(stmt, FUNCTION_FUNCTION)
+	c.defineVariable(global)
+	return nil
+}
+
+func (c *Compiler) VisitIfStmt(stmt *If) interface{} {
+	c.expression(stmt.Condition)
+
+	thenJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	c.statement(stmt.ThenBranch)
+
+	elseJump := c.emitJump(OP_JUMP)
+	c.patchJump(thenJump)
+	c.emitOp(OP_POP)
+
+	if stmt.ElseBranch != nil {
+		c.statement(stmt.ElseBranch)
+	}
+	c.patchJump(elseJump)
+	return nil
+}
+
+func (c *Compiler) VisitPrintStmt(stmt *Print) interface{} {
+	c.expression(stmt.Expression)
+	c.emitOp(OP_PRINT)
+	return nil
+}
+
+func (c *Compiler) VisitReturnStmt(stmt *Return) interface{} {
+	c.mark(stmt.Keyword)
+	if stmt.Value == nil {
+		c.emitReturn()
+		return nil
+	}
+
+	c.expression(stmt.Value)
+	c.emitOp(OP_RETURN)
+	return nil
+}
+
+func (c *Compiler) VisitVarStmt(stmt *Var) interface{} {
+	c.mark(stmt.Name)
+	global := c.parseVariable(stmt.Name)
+
+	if stmt.Initializer != nil {
+		c.expression(stmt.Initializer)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+
+	c.defineVariable(global)
+	return nil
+}
+
+func (c *Compiler) VisitWhileStmt(stmt *While) interface{} {
+	loopStart := len(c.chunk().Code)
+	c.expression(stmt.Condition)
+
+	exitJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	c.statement(stmt.Body)
+	c.emitLoop(loopStart)
+
+	c.patchJump(exitJump)
+	c.emitOp(OP_POP)
+	return nil
+}
+
+// Expressions
+func (c *Compiler) VisitAssignExpr(expr *Assign) interface{} {
+	c.expression(expr.Value)
+	c.mark(expr.Name)
+	c.namedVariable(expr.Name.Lexeme, true)
+	return nil
+}
+
+func (c *Compiler) VisitBinaryExpr(expr *Binary) interface{} {
+	c.expression(expr.Left)
+	c.expression(expr.Right)
+
+	c.mark(expr.Operator)
+	c.markSpan(ExprSpan(expr))
+	switch expr.Operator.Type {
+	case BANG_EQUAL:
+		c.emitBytes(byte(OP_EQUAL), byte(OP_NOT))
+	case EQUAL_EQUAL:
+		c.emitOp(OP_EQUAL)
+	case GREATER:
+		c.emitOp(OP_GREATER)
+	case GREATER_EQUAL:
+		c.emitBytes(byte(OP_LESS), byte(OP_NOT))
+	case LESS:
+		c.emitOp(OP_LESS)
+	case LESS_EQUAL:
+		c.emitBytes(byte(OP_GREATER), byte(OP_NOT))
+	case PLUS:
+		c.emitOp(OP_ADD)
+	case MINUS:
+		c.emitOp(OP_SUBTRACT)
+	case STAR:
+		c.emitOp(OP_MULTIPLY)
+	case PERCENT:
+		c.emitOp(OP_MODULO)
+	case SLASH:
+		c.emitOp(OP_DIVIDE)
+	}
+	return nil
+}
+
+// VisitCallExpr gives each byte of an invoke the span of the error it can
+// raise, so the VM points where the Interpreter would: the opcode at the
+// receiver, the name at the property and the argument count at the call.
+func (c *Compiler) VisitCallExpr(expr *Call) interface{} {
+	// Calling a method straight away skips creating a bound method
+	switch callee := expr.Callee.(type) {
+	case *Get:
+		c.expression(callee.Object)
+		argCount := c.arguments(expr.Arguments)
+		c.mark(expr.Paren)
+		name := c.identifierConstant(callee.Name.Lexeme)
+		op := longForm(OP_INVOKE, name)
+		c.markSpan(ExprSpan(callee))
+		c.emitOp(op)
+		c.markSpan(callee.Name.Span())
+		c.emitIndex(op, name)
+		c.markSpan(ExprSpan(expr))
+		c.emitByte(argCount)
+		return nil
+	case *Super:
+		c.mark(callee.Keyword)
+		c.namedVariable("this", false)
+		argCount := c.arguments(expr.Arguments)
+		c.namedVariable("super", false)
+		c.mark(expr.Paren)
+		c.markSpan(ExprSpan(callee))
+		c.emitIndexed(OP_SUPER_INVOKE, c.identifierConstant(callee.Method.Lexeme))
+		c.markSpan(ExprSpan(expr))
+		c.emitByte(argCount)
+		return nil
+	}
+
+	c.expression(expr.Callee)
+	argCount := c.arguments(expr.Arguments)
+	c.mark(expr.Paren)
+	c.markSpan(ExprSpan(expr))
+	c.emitBytes(byte(OP_CALL), argCount)
+	return nil
+}
+
+// VisitGetExpr points the opcode at the whole expression and the name at
+// the property, for the two errors a lookup can raise.
+func (c *Compiler) VisitGetExpr(expr *Get) interface{} {
+	c.expression(expr.Object)
+	c.mark(expr.Name)
+	name := c.identifierConstant(expr.Name.Lexeme)
+	op := longForm(OP_GET_PROPERTY, name)
+	c.markSpan(ExprSpan(expr))
+	c.emitOp(op)
+	c.mark(expr.Name)
+	c.emitIndex(op, name)
+	return nil
+}
+
+func (c *Compiler) VisitGroupingExpr(expr *Grouping) interface{} {
+	c.expression(expr.Expression)
+	return nil
+}
+
+func (c *Compiler) VisitLiteralExpr(expr *Literal) interface{} {
+	c.mark(expr.Token)
+	switch value := expr.Value.(type) {
+	case nil:
+		c.emitOp(OP_NIL)
+	case bool:
+		if value {
+			c.emitOp(OP_TRUE)
+		} else {
+			c.emitOp(OP_FALSE)
+		}
+	case int64:
+		c.emitConstant(intValue(value))
+	case float64:
+		c.emitConstant(numberValue(value))
+	case string:
+		c.emitConstant(objValue(c.vm.copyString(value)))
+	}
+	return nil
+}
+
+func (c *Compiler) VisitLogicalExpr(expr *Logical) interface{} {
+	c.expression(expr.Left)
+	c.mark(expr.Operator)
+
+	if expr.Operator.Type == AND {
+		endJump := c.emitJump(OP_JUMP_IF_FALSE)
+		c.emitOp(OP_POP)
+		c.expression(expr.Right)
+		c.patchJump(endJump)
+		return nil
+	}
+
+	elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+	endJump := c.emitJump(OP_JUMP)
+	c.patchJump(elseJump)
+	c.emitOp(OP_POP)
+	c.expression(expr.Right)
+	c.patchJump(endJump)
+	return nil
+}
+
+func (c *Compiler) VisitSetExpr(expr *Set) interface{} {
+	c.expression(expr.Object)
+	c.expression(expr.Value)
+	c.mark(expr.Name)
+	c.markSpan(ExprSpan(expr))
+	c.emitIndexed(OP_SET_PROPERTY, c.identifierConstant(expr.Name.Lexeme))
+	return nil
+}
+
+func (c *Compiler) VisitSuperExpr(expr *Super) interface{} {
+	c.mark(expr.Keyword)
+	c.namedVariable("this", false)
+	c.namedVariable("super", false)
+	c.markSpan(ExprSpan(expr))
+	c.emitIndexed(OP_GET_SUPER, c.identifierConstant(expr.Method.Lexeme))
+	return nil
+}
+
+func (c *Compiler) VisitThisExpr(expr *This) interface{} {
+	c.mark(expr.Keyword)
+	c.namedVariable(expr.Keyword.Lexeme, false)
+	return nil
+}
+
+func (c *Compiler) VisitUnaryExpr(expr *Unary) interface{} {
+	c.expression(expr.Right)
+
+	c.mark(expr.Operator)
+	c.markSpan(ExprSpan(expr))
+	switch expr.Operator.Type {
+	case BANG:
+		c.emitOp(OP_NOT)
+	case MINUS:
+		c.emitOp(OP_NEGATE)
+	}
+	return nil
+}
+
+func (c *Compiler) VisitVariableExpr(expr *Variable) interface{} {
+	c.mark(expr.Name)
+	c.namedVariable(expr.Name.Lexeme, false)
+	return nil
+}
+
+// Functions
+func (c *Compiler) beginFunction(functionType FunctionType, name *Token) {
+	c.current = &functionCompiler{
+		enclosing:    c.current,
+		function:     c.vm.newFunction(),
+		functionType: functionType,
+		locals:       []local{},
+		upvalues:     []upvalueRef{},
+	}
+	// Named once reachable so a collection can't free it first
+	if name != nil {
+		c.current.function.Name = c.vm.copyString(name.Lexeme)
+	}
+
+	// Slot zero holds the receiver in methods and the callee otherwise
+	slotZero := ""
+	if functionType == FUNCTION_METHOD || functionType == FUNCTION_INITIALIZER {
+		slotZero = "this"
+	}
+	c.current.locals = append(c.current.locals, local{name: slotZero, depth: 0})
+}
+
+func (c *Compiler) endFunction() *ObjFunction {
+	function := c.current.function
+	function.UpvalueCount = len(c.current.upvalues)
+	c.current = c.current.enclosing
+	return function
+}
+
+func (c *Compiler) function(declaration *Function, functionType FunctionType) {
+	c.beginFunction(functionType, &declaration.Name)
+	c.beginScope()
+
+	for _, param := range declaration.Params {
+		c.current.function.Arity++
+		c.mark(param)
+		constant := c.parseVariable(param)
+		c.defineVariable(constant)
+	}
+
+	for _, statement := range declaration.Body {
+		c.statement(statement)
+	}
+	c.emitReturn()
+
+	// The frame is discarded on return, so there's no endScope
+	upvalues := c.current.upvalues
+	function := c.endFunction()
+
+	c.emitIndexed(OP_CLOSURE, c.makeConstant(objValue(function)))
+	for _, upvalue := range upvalues {
+		isLocal := byte(0)
+		if upvalue.isLocal {
+			isLocal = 1
+		}
+		c.emitBytes(isLocal, upvalue.index)
+	}
+}
+
+func (c *Compiler) arguments(arguments []Expr) byte {
+	for _, argument := range arguments {
+		c.expression(argument)
+	}
+	return byte(len(arguments))
+}
+
+// Variables
+func (c *Compiler) parseVariable(name Token) int {
+	c.declareVariable(name)
+	if c.current.scopeDepth > 0 {
+		return 0
+	}
+	return c.identifierConstant(name.Lexeme)
+}
+
+func (c *Compiler) declareVariable(name Token) {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+	c.addLocal(name.Lexeme)
+}
+
+func (c *Compiler) addLocal(name string) {
+	if len(c.current.locals) > maxByteOperand {
+		c.error(CodeTooManyLocals, "Too many local variables in function.")
+		return
+	}
+	c.current.locals = append(c.current.locals, local{name: name, depth: -1})
+}
+
+func (c *Compiler) defineVariable(global int) {
+	if c.current.scopeDepth > 0 {
+		c.markInitialized()
+		return
+	}
+	c.emitIndexed(OP_DEFINE_GLOBAL, global)
+}
+
+func (c *Compiler) markInitialized() {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+	c.current.locals[len(c.current.locals)-1].depth = c.current.scopeDepth
+}
+
+func (c *Compiler) namedVariable(name string, assign bool) {
+	getOp, setOp := OP_GET_LOCAL, OP_SET_LOCAL
+	arg, ok := c.resolveLocal(c.current, name)
+	if !ok {
+		getOp, setOp = OP_GET_UPVALUE, OP_SET_UPVALUE
+		arg, ok = c.resolveUpvalue(c.current, name)
+	}
+
+	if !ok {
+		global := c.identifierConstant(name)
+		if assign {
+			c.emitIndexed(OP_SET_GLOBAL, global)
+		} else {
+			c.emitIndexed(OP_GET_GLOBAL, global)
+		}
+		return
+	}
+	if assign {
+		c.emitBytes(byte(setOp), arg)
+	} else {
+		c.emitBytes(byte(getOp), arg)
+	}
+}
+
+func (c *Compiler) resolveLocal(compiler *functionCompiler, name string) (byte, bool) {
+	for idx := len(compiler.locals) - 1; idx >= 0; idx-- {
+		if compiler.locals[idx].name == name {
+			return byte(idx), true
+		}
+	}
+	return 0, false
+}
+
+// resolveUpvalue finds name in an enclosing function and threads it down
+// through the upvalues of every function in between.
+func (c *Compiler) resolveUpvalue(compiler *functionCompiler, name string) (byte, bool) {
+	if compiler.enclosing == nil {
+		return 0, false
+	}
+
+	if idx, ok := c.resolveLocal(compiler.enclosing, name); ok {
+		compiler.enclosing.locals[idx].isCaptured = true
+		return c.addUpvalue(compiler, idx, true), true
+	}
+	if idx, ok := c.resolveUpvalue(compiler.enclosing, name); ok {
+		return c.addUpvalue(compiler, idx, false), true
+	}
+	return 0, false
+}
+
+func (c *Compiler) addUpvalue(compiler *functionCompiler, index byte, isLocal bool) byte {
+	for idx, upvalue := range compiler.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return byte(idx)
+		}
+	}
+
+	if len(compiler.upvalues) > maxByteOperand {
+		c.error(CodeTooManyUpvalues, "Too many closure variables in function.")
+		return 0
+	}
+	compiler.upvalues = append(compiler.upvalues, upvalueRef{index: index, isLocal: isLocal})
+	return byte(len(compiler.upvalues) - 1)
+}
+
+func (c *Compiler) identifierConstant(name string) int {
+	return c.makeConstant(objValue(c.vm.copyString(name)))
+}
+
+// Scopes
+func (c *Compiler) beginScope() {
+	c.current.scopeDepth++
+}
+
+func (c *Compiler) endScope() {
+	c.current.scopeDepth--
+
+	locals := c.current.locals
+	for len(locals) > 0 && locals[len(locals)-1].depth > c.current.scopeDepth {
+		if locals[len(locals)-1].isCaptured {
+			c.emitOp(OP_CLOSE_UPVALUE)
+		} else {
+			c.emitOp(OP_POP)
+		}
+		locals = locals[:len(locals)-1]
+	}
+	c.current.locals = locals
+}
+
+// Emitting bytecode
+func (c *Compiler) statement(stmt Stmt) {
+	stmt.Accept(c)
+}
+
+func (c *Compiler) expression(expr Expr) {
+	expr.Accept(c)
+}
+
+func (c *Compiler) chunk() *Chunk {
+	return c.current.function.Chunk
+}
+
+// mark records token as the current position for emitted code and errors.
+// Synthetic tokens without a line keep the previous position.
+func (c *Compiler) mark(token Token) {
+	if token.Line > 0 {
+		c.token = token
+		c.span = token.Span()
+	}
+}
+
+// markSpan sets the span of the code emitted next without moving where
+// compile errors point.
+func (c *Compiler) markSpan(span Span) {
+	if span.IsKnown() {
+		c.span = span
+	}
+}
+
+func (c *Compiler) emitByte(b byte) {
+	c.chunk().Write(b, c.span)
+}
+
+func (c *Compiler) emitBytes(b1, b2 byte) {
+	c.emitByte(b1)
+	c.emitByte(b2)
+}
+
+func (c *Compiler) emitOp(op OpCode) {
+	c.emitByte(byte(op))
+}
+
+func (c *Compiler) emitReturn() {
+	if c.current.functionType == FUNCTION_INITIALIZER {
+		c.emitBytes(byte(OP_GET_LOCAL), 0)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+	c.emitOp(OP_RETURN)
+}
+
+func (c *Compiler) makeConstant(value Value) int {
+	constant := c.chunk().AddConstant(value)
+	if constant > maxLongOperand {
+		c.error(CodeTooManyConstants, "Too many constants in one chunk.")
+		return 0
+	}
+	return constant
+}
+
+func (c *Compiler) emitConstant(value Value) {
+	c.emitIndexed(OP_CONSTANT, c.makeConstant(value))
+}
+
+// emitIndexed writes op followed by the constant index it operates on,
+// switching to op's long form when the index doesn't fit in a byte.
+func (c *Compiler) emitIndexed(op OpCode, index int) {
+	op = longForm(op, index)
+	c.emitOp(op)
+	c.emitIndex(op, index)
+}
+
+// emitIndex writes a constant index as the operand of op.
+func (c *Compiler) emitIndex(op OpCode, index int) {
+	if op.isLong() {
+		c.emitBytes(byte(index>>16), byte(index>>8))
+	}
+	c.emitByte(byte(index))
+}
+
+// longForm returns the form of op that can hold index.
+func longForm(op OpCode, index int) OpCode {
+	if index > maxByteOperand {
+		return longForms[op]
+	}
+	return op
+}
+
+// emitJump writes a jump with a placeholder offset and returns where the
+// offset lives so patchJump can fill it in.
+func (c *Compiler) emitJump(op OpCode) int {
+	c.emitOp(op)
+	c.emitBytes(0xff, 0xff)
+	return len(c.chunk().Code) - 2
+}
+
+func (c *Compiler) patchJump(offset int) {
+	// -2 to adjust for the bytecode of the jump offset itself
+	jump := len(c.chunk().Code) - offset - 2
+	if jump > math.MaxUint16 {
+		c.error(CodeJumpTooLarge, "Too much code to jump over.")
+	}
+
+	c.chunk().Code[offset] = byte(jump >> 8)
+	c.chunk().Code[offset+1] = byte(jump)
+}
+
+func (c *Compiler) emitLoop(loopStart int) {
+	c.emitOp(OP_LOOP)
+
+	offset := len(c.chunk().Code) - loopStart + 2
+	if offset > math.MaxUint16 {
+		c.error(CodeJumpTooLarge, "Loop body too large.")
+	}
+	c.emitBytes(byte(offset>>8), byte(offset))
+}
+
+func (c *Compiler) error(code string, message string) {
+	c.reporter.report(tokenDiagnostic(code, c.token, message))
+}
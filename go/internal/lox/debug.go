@@ -0,0 +1,125 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DisassembleFunction prints the bytecode of function followed by that of
+// every function it declares.
+func DisassembleFunction(w io.Writer, function *ObjFunction) {
+	DisassembleChunk(w, function.Chunk, function.String())
+
+	for _, constant := range function.Chunk.Constants {
+		if nested, ok := constant.obj.(*ObjFunction); ok {
+			fmt.Fprintln(w)
+			DisassembleFunction(w, nested)
+		}
+	}
+}
+
+// DisassembleChunk prints every instruction in chunk under a name header.
+func DisassembleChunk(w io.Writer, chunk *Chunk, name string) {
+	fmt.Fprintf(w, "== %s ==\n", name)
+
+	for offset := 0; offset < len(chunk.Code); {
+		offset = DisassembleInstruction(w, chunk, offset)
+	}
+}
+
+// DisassembleInstruction prints the instruction at offset as its offset,
+// source line, opcode name and decoded operands, and returns the offset of
+// the next instruction.
+func DisassembleInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
+	if offset > 0 && chunk.Line(offset) == chunk.Line(offset-1) {
+		fmt.Fprint(w, "   | ")
+	} else {
+		fmt.Fprintf(w, "%4d ", chunk.Line(offset))
+	}
+
+	instruction := OpCode(chunk.Code[offset])
+	switch instruction {
+	case OP_CONSTANT, OP_GET_GLOBAL, OP_DEFINE_GLOBAL, OP_SET_GLOBAL,
+		OP_GET_PROPERTY, OP_SET_PROPERTY, OP_GET_SUPER, OP_CLASS, OP_METHOD,
+		OP_CONSTANT_LONG, OP_GET_GLOBAL_LONG, OP_DEFINE_GLOBAL_LONG, OP_SET_GLOBAL_LONG,
+		OP_GET_PROPERTY_LONG, OP_SET_PROPERTY_LONG, OP_GET_SUPER_LONG, OP_CLASS_LONG, OP_METHOD_LONG:
+		return constantInstruction(w, instruction, chunk, offset)
+	case OP_GET_LOCAL, OP_SET_LOCAL, OP_GET_UPVALUE, OP_SET_UPVALUE, OP_CALL:
+		return byteInstruction(w, instruction, chunk, offset)
+	case OP_JUMP, OP_JUMP_IF_FALSE:
+		return jumpInstruction(w, instruction, 1, chunk, offset)
+	case OP_LOOP:
+		return jumpInstruction(w, instruction, -1, chunk, offset)
+	case OP_INVOKE, OP_SUPER_INVOKE, OP_INVOKE_LONG, OP_SUPER_INVOKE_LONG:
+		return invokeInstruction(w, instruction, chunk, offset)
+	case OP_CLOSURE, OP_CLOSURE_LONG:
+		return closureInstruction(w, instruction, chunk, offset)
+	default:
+		fmt.Fprintln(w, instruction)
+		return offset + 1
+	}
+}
+
+func constantInstruction(w io.Writer, op OpCode, chunk *Chunk, offset int) int {
+	constant, offset := constantOperand(op, chunk, offset)
+	fmt.Fprintf(w, "%-16s %4d '%s'\n", op, constant, chunk.Constants[constant])
+	return offset
+}
+
+// constantOperand decodes the constant index of the instruction op at
+// offset and returns it with the offset just past it.
+func constantOperand(op OpCode, chunk *Chunk, offset int) (int, int) {
+	constant := int(chunk.Code[offset+1])
+	if op.isLong() {
+		constant = constant<<16 | int(chunk.Code[offset+2])<<8 | int(chunk.Code[offset+3])
+	}
+	return constant, offset + 1 + op.constantWidth()
+}
+
+func byteInstruction(w io.Writer, op OpCode, chunk *Chunk, offset int) int {
+	slot := chunk.Code[offset+1]
+	fmt.Fprintf(w, "%-16s %4d\n", op, slot)
+	return offset + 2
+}
+
+func jumpInstruction(w io.Writer, op OpCode, sign int, chunk *Chunk, offset int) int {
+	jump := int(chunk.Code[offset+1])<<8 | int(chunk.Code[offset+2])
+	fmt.Fprintf(w, "%-16s %4d -> %d\n", op, offset, offset+3+sign*jump)
+	return offset + 3
+}
+
+func invokeInstruction(w io.Writer, op OpCode, chunk *Chunk, offset int) int {
+	constant, offset := constantOperand(op, chunk, offset)
+	argCount := chunk.Code[offset]
+	fmt.Fprintf(w, "%-16s (%d args) %4d '%s'\n", op, argCount, constant, chunk.Constants[constant])
+	return offset + 1
+}
+
+func closureInstruction(w io.Writer, op OpCode, chunk *Chunk, offset int) int {
+	constant, offset := constantOperand(op, chunk, offset)
+	function := chunk.Constants[constant].obj.(*ObjFunction)
+	fmt.Fprintf(w, "%-16s %4d %s\n", op, constant, function)
+
+	for range function.UpvalueCount {
+		kind := "upvalue"
+		if chunk.Code[offset] == 1 {
+			kind = "local"
+		}
+		fmt.Fprintf(w, "%04d    |                     %s %d\n", offset, kind, chunk.Code[offset+1])
+		offset += 2
+	}
+	return offset
+}
+
+// traceStack formats the VM's value stack the way the trace prints it
+// before each instruction.
+func traceStack(stack []Value) string {
+	var builder strings.Builder
+	builder.WriteString("          ")
+	for _, value := range stack {
+		fmt.Fprintf(&builder, "[ %s ]", value)
+	}
+	return builder.String()
+}
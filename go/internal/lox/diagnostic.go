@@ -0,0 +1,265 @@
+package lox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrStatic is returned when scanning, parsing or resolving found errors.
+var ErrStatic = errors.New("static errors in source")
+
+// Diagnostic codes group errors by the phase that reports them: E00xx from
+// the Scanner, E01xx from the Parser, E02xx from the Resolver, E03xx at
+// runtime and E04xx from the bytecode Compiler.
+const (
+	CodeUnexpectedCharacter = "E0001"
+	CodeUnterminatedString  = "E0002"
+	CodeUnterminatedComment = "E0003"
+	CodeInvalidNumber       = "E0004"
+	CodeInvalidEscape       = "E0005"
+	CodeInvalidUTF8         = "E0006"
+
+	CodeSyntax            = "E0100"
+	CodeInvalidAssignment = "E0101"
+	CodeTooManyArguments  = "E0102"
+
+	CodeSelfInitializer        = "E0200"
+	CodeDuplicateDeclaration   = "E0201"
+	CodeTopLevelReturn         = "E0202"
+	CodeInitializerReturn      = "E0203"
+	CodeThisOutsideClass       = "E0204"
+	CodeSuperOutsideClass      = "E0205"
+	CodeSuperWithoutSuperclass = "E0206"
+	CodeSelfInheritance        = "E0207"
+
+	CodeRuntime = "E0300"
+
+	CodeTooManyLocals    = "E0400"
+	CodeTooManyUpvalues  = "E0401"
+	CodeTooManyConstants = "E0402"
+	CodeJumpTooLarge     = "E0403"
+)
+
+// Diagnostic is one error located in the source.
+type Diagnostic struct {
+	Code    string
+	Message string
+	// Where names the offending token, e.g. "at 'x'" or "at end".
+	Where string
+	Span  Span
+	Notes []string
+}
+
+func tokenDiagnostic(code string, token Token, message string, notes ...string) Diagnostic {
+	where := "at '" + token.Lexeme + "'"
+	if token.Type == EOF {
+		where = "at end"
+	}
+	return Diagnostic{
+		Code:    code,
+		Message: message,
+		Where:   where,
+		Span:    token.Span(),
+		Notes:   notes,
+	}
+}
+
+// String is the single line form, e.g. "[line 1:5] Error at ';': message".
+func (d Diagnostic) String() string {
+	var location string
+	if d.Span.Column != 0 {
+		location = fmt.Sprintf("[line %d:%d] ", d.Span.Line, d.Span.Column)
+	} else if d.Span.IsKnown() {
+		location = fmt.Sprintf("[line %d] ", d.Span.Line)
+	}
+	if d.Where == "" {
+		return fmt.Sprintf("%sError: %s", location, d.Message)
+	}
+	return fmt.Sprintf("%sError %s: %s", location, d.Where, d.Message)
+}
+
+// Render formats the diagnostic with the offending line of source and the
+// span underlined, followed by any notes. name labels the source.
+func (d Diagnostic) Render(name, source string) string {
+	var builder strings.Builder
+	if d.Code == "" {
+		fmt.Fprintf(&builder, "error: %s\n", d.Message)
+	} else {
+		fmt.Fprintf(&builder, "error[%s]: %s\n", d.Code, d.Message)
+	}
+
+	if d.Span.IsKnown() {
+		gutter := len(fmt.Sprint(d.Span.Line))
+		pad := strings.Repeat(" ", gutter)
+		if d.Span.Column == 0 {
+			fmt.Fprintf(&builder, "%s--> %s:%d\n", pad, name, d.Span.Line)
+		} else {
+			fmt.Fprintf(&builder, "%s--> %s:%d:%d\n", pad, name, d.Span.Line, d.Span.Column)
+		}
+
+		// Compiled scripts and earlier runs carry spans but not the source
+		// they point into
+		lineStart, ok := 0, false
+		if source != "" && d.Span.Start <= len(source) {
+			lineStart, ok = d.lineStart(source)
+		}
+		if ok {
+			lineEnd := len(source)
+			if idx := strings.IndexByte(source[lineStart:], '\n'); idx >= 0 {
+				lineEnd = lineStart + idx
+			}
+			text := strings.TrimRight(source[lineStart:lineEnd], "\r")
+
+			fmt.Fprintf(&builder, "%s |\n", pad)
+			fmt.Fprintf(&builder, "%d | %s\n", d.Span.Line, text)
+			if d.Span.Column != 0 {
+				fmt.Fprintf(&builder, "%s | %s\n", pad, underline(text, d.Span.Start-lineStart, d.Span.End-lineStart))
+			}
+		}
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(&builder, "  = note: %s\n", note)
+	}
+	return builder.String()
+}
+
+// lineStart returns the offset of the line the span starts on. Spans
+// without a column only know their line.
+func (d Diagnostic) lineStart(source string) (int, bool) {
+	if d.Span.Column != 0 {
+		return strings.LastIndexByte(source[:d.Span.Start], '\n') + 1, true
+	}
+
+	start := 0
+	for line := 1; line < d.Span.Line; line++ {
+		idx := strings.IndexByte(source[start:], '\n')
+		if idx < 0 {
+			return 0, false
+		}
+		start += idx + 1
+	}
+	return start, true
+}
+
+// underline places carets under text[start:end], clipped to the line and
+// at least one wide. Offsets are bytes but carets are one per rune, and
+// tabs before the carets are kept so they line up.
+func underline(text string, start, end int) string {
+	start = min(start, len(text))
+	end = min(max(end, start), len(text))
+
+	var builder strings.Builder
+	for _, c := range text[:start] {
+		if c == '\t' {
+			builder.WriteByte('\t')
+		} else {
+			builder.WriteByte(' ')
+		}
+	}
+	builder.WriteString(strings.Repeat("^", max(utf8.RuneCountInString(text[start:end]), 1)))
+	return builder.String()
+}
+
+// Reporter collects the diagnostics of a single run so the Scanner, Parser
+// and Resolver don't share error state across runs.
+type Reporter struct {
+	out         io.Writer
+	name        string
+	source      strings.Builder
+	diagnostics []Diagnostic
+	// origin tags the tokens scanned from source, telling them apart from
+	// those of earlier runs.
+	origin *Source
+
+	// pending holds diagnostics waiting for the rest of their source line
+	// to be read, until complete is set once all of the source has been.
+	pending  []Diagnostic
+	complete bool
+}
+
+// NewReporter renders each diagnostic against source to out as it arrives.
+func NewReporter(out io.Writer, name, source string) *Reporter {
+	reporter := NewStreamReporter(out, name)
+	reporter.source.WriteString(source)
+	reporter.complete = true
+	return reporter
+}
+
+// NewStreamReporter is NewReporter for source that is still being read.
+// The source must be read through Source, and sourceDone called once it
+// all has been.
+func NewStreamReporter(out io.Writer, name string) *Reporter {
+	return &Reporter{
+		out:         out,
+		name:        name,
+		diagnostics: []Diagnostic{},
+		origin:      &Source{Name: name},
+	}
+}
+
+func (r *Reporter) HadError() bool {
+	return len(r.diagnostics) > 0
+}
+
+func (r *Reporter) Diagnostics() []Diagnostic {
+	return r.diagnostics
+}
+
+// Source returns a reader of in that keeps what it reads, so diagnostics
+// can quote the lines they point at. All of it is kept for as long as the
+// Reporter is, since a runtime error can point at any line.
+func (r *Reporter) Source(in io.Reader) io.Reader {
+	return io.TeeReader(in, reporterSource{r})
+}
+
+// reporterSource adds what's written to it to the Reporter's source.
+type reporterSource struct {
+	reporter *Reporter
+}
+
+func (w reporterSource) Write(p []byte) (int, error) {
+	w.reporter.source.Write(p)
+	w.reporter.flush()
+	return len(p), nil
+}
+
+// sourceDone renders any diagnostics still waiting on their line.
+func (r *Reporter) sourceDone() {
+	r.complete = true
+	r.flush()
+}
+
+func (r *Reporter) report(diagnostic Diagnostic) {
+	r.diagnostics = append(r.diagnostics, diagnostic)
+	r.pending = append(r.pending, diagnostic)
+	r.flush()
+}
+
+// render renders diagnostic against the source read so far. A span from
+// an earlier run's source, whose text is gone, only gets its position.
+func (r *Reporter) render(diagnostic Diagnostic) string {
+	if origin := diagnostic.Span.Source; origin != nil && origin != r.origin {
+		return diagnostic.Render(origin.Name, "")
+	}
+	return diagnostic.Render(r.name, r.source.String())
+}
+
+// flush renders pending diagnostics, in order, as soon as the line each
+// starts on has been read in full.
+func (r *Reporter) flush() {
+	source := r.source.String()
+	for len(r.pending) > 0 {
+		span := r.pending[0].Span
+		lineRead := span.Column == 0 || span.Start > len(source) ||
+			strings.IndexByte(source[span.Start:], '\n') >= 0
+		if !r.complete && !lineRead {
+			return
+		}
+		fmt.Fprint(r.out, r.render(r.pending[0]))
+		r.pending = r.pending[1:]
+	}
+}
@@ -0,0 +1,105 @@
+package lox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DotPrinter renders expression trees as a Graphviz DOT digraph, one node
+// per expression with edges to its operands in order. Operators are boxes
+// and leaves like literals and variables are ellipses.
+type DotPrinter struct {
+	builder strings.Builder
+	nodes   int
+}
+
+func NewDotPrinter() *DotPrinter {
+	return &DotPrinter{}
+}
+
+// Print renders exprs into a single graph, each as its own tree.
+func (dp *DotPrinter) Print(exprs ...Expr) string {
+	dp.builder.Reset()
+	dp.nodes = 0
+
+	dp.builder.WriteString("digraph AST {\n")
+	dp.builder.WriteString("\tordering=out;\n")
+	dp.builder.WriteString("\tnode [shape=box];\n")
+	for _, expr := range exprs {
+		expr.Accept(dp)
+	}
+	dp.builder.WriteString("}\n")
+	return dp.builder.String()
+}
+
+func (dp *DotPrinter) VisitAssignExpr(expr *Assign) interface{} {
+	return dp.node("= "+expr.Name.Lexeme, expr.Value)
+}
+
+func (dp *DotPrinter) VisitBinaryExpr(expr *Binary) interface{} {
+	return dp.node(expr.Operator.Lexeme, expr.Left, expr.Right)
+}
+
+func (dp *DotPrinter) VisitCallExpr(expr *Call) interface{} {
+	return dp.node("call", append([]Expr{expr.Callee}, expr.Arguments...)...)
+}
+
+func (dp *DotPrinter) VisitGetExpr(expr *Get) interface{} {
+	return dp.node("."+expr.Name.Lexeme, expr.Object)
+}
+
+func (dp *DotPrinter) VisitGroupingExpr(expr *Grouping) interface{} {
+	return dp.node("( )", expr.Expression)
+}
+
+func (dp *DotPrinter) VisitLiteralExpr(expr *Literal) interface{} {
+	return dp.leaf(literalSource(expr.Value))
+}
+
+func (dp *DotPrinter) VisitLogicalExpr(expr *Logical) interface{} {
+	return dp.node(expr.Operator.Lexeme, expr.Left, expr.Right)
+}
+
+func (dp *DotPrinter) VisitSetExpr(expr *Set) interface{} {
+	return dp.node("."+expr.Name.Lexeme+" =", expr.Object, expr.Value)
+}
+
+func (dp *DotPrinter) VisitSuperExpr(expr *Super) interface{} {
+	return dp.leaf("super." + expr.Method.Lexeme)
+}
+
+func (dp *DotPrinter) VisitThisExpr(expr *This) interface{} {
+	return dp.leaf("this")
+}
+
+func (dp *DotPrinter) VisitUnaryExpr(expr *Unary) interface{} {
+	return dp.node(expr.Operator.Lexeme, expr.Right)
+}
+
+func (dp *DotPrinter) VisitVariableExpr(expr *Variable) interface{} {
+	return dp.leaf(expr.Name.Lexeme)
+}
+
+// node writes a node labelled label with edges to children and returns its
+// id.
+func (dp *DotPrinter) node(label string, children ...Expr) string {
+	id := dp.nextID()
+	fmt.Fprintf(&dp.builder, "\t%s [label=%s];\n", id, strconv.Quote(label))
+	for _, child := range children {
+		fmt.Fprintf(&dp.builder, "\t%s -> %s;\n", id, child.Accept(dp).(string))
+	}
+	return id
+}
+
+func (dp *DotPrinter) leaf(label string) string {
+	id := dp.nextID()
+	fmt.Fprintf(&dp.builder, "\t%s [label=%s, shape=ellipse];\n", id, strconv.Quote(label))
+	return id
+}
+
+func (dp *DotPrinter) nextID() string {
+	id := fmt.Sprintf("n%d", dp.nodes)
+	dp.nodes++
+	return id
+}
@@ -0,0 +1,70 @@
+package lox
+
+type Environment struct {
+	enclosing *Environment
+	values    map[string]any
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{
+		enclosing: nil,
+		values:    make(map[string]any),
+	}
+}
+
+func NewEnclosedEnvironment(enclosing *Environment) *Environment {
+	return &Environment{
+		enclosing: enclosing,
+		values:    make(map[string]any),
+	}
+}
+
+func (e *Environment) Define(name string, value any) {
+	e.values[name] = value
+}
+
+func (e *Environment) Get(name Token) any {
+	if value, ok := e.values[name.Lexeme]; ok {
+		return value
+	}
+	if e.enclosing != nil {
+		return e.enclosing.Get(name)
+	}
+	panic(&RuntimeError{
+		Token:   &name,
+		Message: "Undefined variable '" + name.Lexeme + "'.",
+	})
+}
+
+func (e *Environment) Assign(name Token, value any) {
+	if _, ok := e.values[name.Lexeme]; ok {
+		e.values[name.Lexeme] = value
+		return
+	}
+	if e.enclosing != nil {
+		e.enclosing.Assign(name, value)
+		return
+	}
+	panic(&RuntimeError{
+		Token:   &name,
+		Message: "Undefined variable '" + name.Lexeme + "'.",
+	})
+}
+
+// GetAt reads name from the scope exactly distance hops up the chain, as
+// computed by the Resolver.
+func (e *Environment) GetAt(distance int, name string) any {
+	return e.ancestor(distance).values[name]
+}
+
+func (e *Environment) AssignAt(distance int, name Token, value any) {
+	e.ancestor(distance).values[name.Lexeme] = value
+}
+
+func (e *Environment) ancestor(distance int) *Environment {
+	environment := e
+	for range distance {
+		environment = environment.enclosing
+	}
+	return environment
+}
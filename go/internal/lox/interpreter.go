@@ -1,52 +1,213 @@
 package lox
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"io"
+)
 
 type RuntimeError struct {
 	Token   *Token
 	Message string
+	// Span covers the whole offending expression. When unknown the
+	// diagnostic falls back to the span of Token.
+	Span Span
+
+	// cause is the context error when execution was cancelled
+	cause error
 }
 
 func (r *RuntimeError) Error() string {
+	if r.Token == nil {
+		if r.Span.IsKnown() {
+			return fmt.Sprintf("Runtime error: %s\n[line %d]", r.Message, r.Span.Line)
+		}
+		return fmt.Sprintf("Runtime error: %s", r.Message)
+	}
 	return fmt.Sprintf("Runtime error: %s\n[line %d]", r.Message, r.Token.Line)
 }
 
-type Interpreter struct{}
+func (r *RuntimeError) Diagnostic() Diagnostic {
+	span := r.Span
+	if !span.IsKnown() && r.Token != nil {
+		span = r.Token.Span()
+	}
+	return Diagnostic{
+		Code:    CodeRuntime,
+		Message: r.Message,
+		Span:    span,
+	}
+}
+
+func (r *RuntimeError) Unwrap() error {
+	return r.cause
+}
+
+// maxCallDepth bounds nested calls so runaway recursion is a runtime error
+// rather than a Go stack overflow. Each call takes a few Go frames, so
+// this stays well within Go's stack limit.
+const maxCallDepth = 10000
+
+type Interpreter struct {
+	globals     *Environment
+	environment *Environment
+	callDepth   int
+
+	stdout io.Writer
+	ctx    context.Context
+}
+
+// returnValue is what a return statement evaluates to. Statements hand it
+// back up through execute until the enclosing LoxFunction.Call receives it.
+type returnValue struct {
+	value any
+}
+
+func NewInterpreter(stdout io.Writer) *Interpreter {
+	globals := NewEnvironment()
+	interpreter := &Interpreter{
+		globals:     globals,
+		environment: globals,
+		stdout:      stdout,
+		ctx:         context.Background(),
+	}
+	interpreter.defineNatives()
+	return interpreter
+}
 
-func NewInterpreter() *Interpreter {
-	return &Interpreter{}
+// DefineNative exposes a Go function to scripts as a global named name.
+func (i *Interpreter) DefineNative(name string, arity int, fn NativeFn) {
+	i.globals.Define(name, NewNativeFunction(name, arity, fn))
 }
 
-func (i *Interpreter) Interpret(expr Expr) (string, error) {
+// Interpret executes the statements in order and returns the value of the
+// last one, which is only non-nil for expression statements. Loops and calls
+// stop with a RuntimeError wrapping ctx.Err() once ctx is done.
+func (i *Interpreter) Interpret(ctx context.Context, statements []Stmt) (result any, err error) {
+	i.ctx = ctx
 	defer func() {
+		i.ctx = context.Background()
+
 		if r := recover(); r != nil {
-			if _, ok := r.(*RuntimeError); ok {
+			if runtimeErr, ok := r.(*RuntimeError); ok {
+				result, err = nil, runtimeErr
 			} else {
 				panic(r)
 			}
 		}
 	}()
 
-	// Capture runtime error if one occurs
-	var result string
-	var err error
+	for _, statement := range statements {
+		result = i.execute(statement)
+		if _, ok := result.(*returnValue); ok {
+			return nil, nil
+		}
+	}
+	return result, nil
+}
 
-	func() {
-		defer func() {
-			if r := recover(); r != nil {
-				if runtimeErr, ok := r.(*RuntimeError); ok {
-					err = runtimeErr
-				} else {
-					panic(r)
-				}
-			}
-		}()
+// Statements
+func (i *Interpreter) VisitBlockStmt(stmt *Block) interface{} {
+	return i.executeBlock(stmt.Statements, NewEnclosedEnvironment(i.environment))
+}
 
-		value := i.evaluate(expr)
-		result = i.stringify(value)
-	}()
+func (i *Interpreter) VisitClassStmt(stmt *Class) interface{} {
+	var superclass *LoxClass
+	if stmt.Superclass != nil {
+		class, ok := i.evaluate(stmt.Superclass).(*LoxClass)
+		if !ok {
+			panic(&RuntimeError{
+				Token:   &stmt.Superclass.Name,
+				Message: "Superclass must be a class.",
+			})
+		}
+		superclass = class
+	}
+
+	i.environment.Define(stmt.Name.Lexeme, nil)
+
+	// Methods close over an extra scope that binds "super"
+	if superclass != nil {
+		i.environment = NewEnclosedEnvironment(i.environment)
+		i.environment.Define("super", superclass)
+	}
+
+	methods := make(map[string]*LoxFunction, len(stmt.Methods))
+	for _, method := range stmt.Methods {
+		methods[method.Name.Lexeme] = NewLoxFunction(method, i.environment, method.Name.Lexeme == "init")
+	}
+
+	class := NewLoxClass(stmt.Name.Lexeme, superclass, methods)
+
+	if superclass != nil {
+		i.environment = i.environment.enclosing
+	}
+
+	i.environment.Assign(stmt.Name, class)
+	return nil
+}
 
-	return result, err
+func (i *Interpreter) VisitExpressionStmt(stmt *Expression) interface{} {
+	return i.evaluate(stmt.Expression)
+}
+
+func (i *Interpreter) VisitFunctionStmt(stmt *Function) interface{} {
+	function := NewLoxFunction(stmt, i.environment, false)
+	i.environment.Define(stmt.Name.Lexeme, function)
+	return nil
+}
+
+func (i *Interpreter) VisitIfStmt(stmt *If) interface{} {
+	if i.isTruthy(i.evaluate(stmt.Condition)) {
+		return i.completion(i.execute(stmt.ThenBranch))
+	} else if stmt.ElseBranch != nil {
+		return i.completion(i.execute(stmt.ElseBranch))
+	}
+	return nil
+}
+
+func (i *Interpreter) VisitPrintStmt(stmt *Print) interface{} {
+	value := i.evaluate(stmt.Expression)
+	fmt.Fprintln(i.stdout, i.stringify(value))
+	return nil
+}
+
+func (i *Interpreter) VisitVarStmt(stmt *Var) interface{} {
+	var value any
+	if stmt.Initializer != nil {
+		value = i.evaluate(stmt.Initializer)
+	}
+	i.environment.Define(stmt.Name.Lexeme, value)
+	return nil
+}
+
+func (i *Interpreter) VisitReturnStmt(stmt *Return) interface{} {
+	var value any
+	if stmt.Value != nil {
+		value = i.evaluate(stmt.Value)
+	}
+	return &returnValue{value: value}
+}
+
+func (i *Interpreter) VisitWhileStmt(stmt *While) interface{} {
+	for i.isTruthy(i.evaluate(stmt.Condition)) {
+		i.checkContext(nil)
+		if ret := i.completion(i.execute(stmt.Body)); ret != nil {
+			return ret
+		}
+	}
+	return nil
+}
+
+// Expressions
+func (i *Interpreter) VisitAssignExpr(expr *Assign) interface{} {
+	value := i.evaluate(expr.Value)
+	if expr.Depth >= 0 {
+		i.environment.AssignAt(expr.Depth, expr.Name, value)
+	} else {
+		i.globals.Assign(expr.Name, value)
+	}
+	return value
 }
 
 func (i *Interpreter) VisitBinaryExpr(expr *Binary) interface{} {
@@ -54,16 +215,14 @@ func (i *Interpreter) VisitBinaryExpr(expr *Binary) interface{} {
 	right := i.evaluate(expr.Right)
 
 	switch expr.Operator.Type {
-	case MINUS:
-		i.checkNumberOperands(&expr.Operator, left, right)
-		return left.(float64) - right.(float64)
+	case MINUS, SLASH, STAR, PERCENT:
+		i.checkNumberOperands(expr, &expr.Operator, left, right)
+		return i.arithmetic(expr, left, right)
 	case PLUS:
-		switch l := left.(type) {
-		case float64:
-			if r, ok := right.(float64); ok {
-				return l + r
-			}
-		case string:
+		if isNumber(left) && isNumber(right) {
+			return i.arithmetic(expr, left, right)
+		}
+		if l, ok := left.(string); ok {
 			if r, ok := right.(string); ok {
 				return l + r
 			}
@@ -71,32 +230,16 @@ func (i *Interpreter) VisitBinaryExpr(expr *Binary) interface{} {
 		panic(&RuntimeError{
 			Token:   &expr.Operator,
 			Message: "Operands must be two numbers or two strings.",
+			Span:    ExprSpan(expr),
 		})
-	case SLASH:
-		i.checkNumberOperands(&expr.Operator, left, right)
-		rightNum := right.(float64)
-		if rightNum == 0 {
-			panic(&RuntimeError{
-				Token:   &expr.Operator,
-				Message: "Division by zero.",
-			})
+	case GREATER, GREATER_EQUAL, LESS, LESS_EQUAL:
+		i.checkNumberOperands(expr, &expr.Operator, left, right)
+		if l, ok := left.(int64); ok {
+			if r, ok := right.(int64); ok {
+				return compareNumbers(expr.Operator.Type, l, r)
+			}
 		}
-		return left.(float64) / rightNum
-	case STAR:
-		i.checkNumberOperands(&expr.Operator, left, right)
-		return left.(float64) * right.(float64)
-	case GREATER:
-		i.checkNumberOperands(&expr.Operator, left, right)
-		return left.(float64) > right.(float64)
-	case GREATER_EQUAL:
-		i.checkNumberOperands(&expr.Operator, left, right)
-		return left.(float64) >= right.(float64)
-	case LESS:
-		i.checkNumberOperands(&expr.Operator, left, right)
-		return left.(float64) < right.(float64)
-	case LESS_EQUAL:
-		i.checkNumberOperands(&expr.Operator, left, right)
-		return left.(float64) <= right.(float64)
+		return compareNumbers(expr.Operator.Type, toFloat(left), toFloat(right))
 	case BANG_EQUAL:
 		return !i.isEqual(left, right)
 	case EQUAL_EQUAL:
@@ -105,6 +248,70 @@ func (i *Interpreter) VisitBinaryExpr(expr *Binary) interface{} {
 	return nil
 }
 
+func (i *Interpreter) VisitCallExpr(expr *Call) interface{} {
+	i.checkContext(&expr.Paren)
+	callee := i.evaluate(expr.Callee)
+
+	arguments := make([]any, 0, len(expr.Arguments))
+	for _, argument := range expr.Arguments {
+		arguments = append(arguments, i.evaluate(argument))
+	}
+
+	function, ok := callee.(LoxCallable)
+	if !ok {
+		panic(&RuntimeError{
+			Token:   &expr.Paren,
+			Message: "Can only call functions and classes.",
+			Span:    ExprSpan(expr),
+		})
+	}
+	if len(arguments) != function.Arity() {
+		panic(&RuntimeError{
+			Token:   &expr.Paren,
+			Message: fmt.Sprintf("Expected %d arguments but got %d.", function.Arity(), len(arguments)),
+			Span:    ExprSpan(expr),
+		})
+	}
+
+	// Natives report failures as errors, which belong to this call site
+	if native, ok := function.(*NativeFunction); ok {
+		value, err := native.invoke(arguments)
+		if err != nil {
+			panic(&RuntimeError{
+				Token:   &expr.Paren,
+				Message: err.Error(),
+				Span:    ExprSpan(expr),
+			})
+		}
+		return value
+	}
+
+	if i.callDepth == maxCallDepth {
+		panic(&RuntimeError{
+			Token:   &expr.Paren,
+			Message: "Stack overflow.",
+			Span:    ExprSpan(expr),
+		})
+	}
+	i.callDepth++
+	defer func() {
+		i.callDepth--
+	}()
+	return function.Call(i, arguments)
+}
+
+func (i *Interpreter) VisitGetExpr(expr *Get) interface{} {
+	object := i.evaluate(expr.Object)
+	if instance, ok := object.(*LoxInstance); ok {
+		return instance.Get(expr.Name)
+	}
+	panic(&RuntimeError{
+		Token:   &expr.Name,
+		Message: "Only instances have properties.",
+		Span:    ExprSpan(expr),
+	})
+}
+
 func (i *Interpreter) VisitGroupingExpr(expr *Grouping) interface{} {
 	return i.evaluate(expr.Expression)
 }
@@ -113,11 +320,76 @@ func (i *Interpreter) VisitLiteralExpr(expr *Literal) interface{} {
 	return expr.Value
 }
 
+// VisitLogicalExpr short-circuits and yields the deciding operand itself
+func (i *Interpreter) VisitLogicalExpr(expr *Logical) interface{} {
+	left := i.evaluate(expr.Left)
+
+	if expr.Operator.Type == OR {
+		if i.isTruthy(left) {
+			return left
+		}
+	} else {
+		if !i.isTruthy(left) {
+			return left
+		}
+	}
+	return i.evaluate(expr.Right)
+}
+
+func (i *Interpreter) VisitSetExpr(expr *Set) interface{} {
+	object := i.evaluate(expr.Object)
+	instance, ok := object.(*LoxInstance)
+	if !ok {
+		panic(&RuntimeError{
+			Token:   &expr.Name,
+			Message: "Only instances have fields.",
+			Span:    ExprSpan(expr),
+		})
+	}
+
+	value := i.evaluate(expr.Value)
+	instance.Set(expr.Name, value)
+	return value
+}
+
+func (i *Interpreter) VisitSuperExpr(expr *Super) interface{} {
+	distance := expr.Depth
+	superclass := i.environment.GetAt(distance, "super").(*LoxClass)
+
+	// "this" always lives in the scope just inside the one binding "super"
+	object := i.environment.GetAt(distance-1, "this").(*LoxInstance)
+
+	method := superclass.FindMethod(expr.Method.Lexeme)
+	if method == nil {
+		panic(&RuntimeError{
+			Token:   &expr.Method,
+			Message: "Undefined property '" + expr.Method.Lexeme + "'.",
+			Span:    ExprSpan(expr),
+		})
+	}
+	return method.Bind(object)
+}
+
+func (i *Interpreter) VisitThisExpr(expr *This) interface{} {
+	return i.lookUpVariable(expr.Keyword, expr.Depth)
+}
+
 func (i *Interpreter) VisitUnaryExpr(expr *Unary) interface{} {
 	right := i.evaluate(expr.Right)
 	switch expr.Operator.Type {
 	case MINUS:
-		i.checkNumberOperand(&expr.Operator, right)
+		i.checkNumberOperand(expr, &expr.Operator, right)
+		if n, ok := right.(int64); ok {
+			negated, err := intArithmetic(MINUS, 0, n)
+			if err != nil {
+				panic(&RuntimeError{
+					Token:   &expr.Operator,
+					Message: err.Error(),
+					Span:    ExprSpan(expr),
+				})
+			}
+			return negated
+		}
 		return -right.(float64)
 	case BANG:
 		return !i.isTruthy(right)
@@ -125,10 +397,88 @@ func (i *Interpreter) VisitUnaryExpr(expr *Unary) interface{} {
 	return nil
 }
 
+func (i *Interpreter) VisitVariableExpr(expr *Variable) interface{} {
+	return i.lookUpVariable(expr.Name, expr.Depth)
+}
+
+// lookUpVariable reads name from depth scopes out, or from the globals
+// when depth is -1.
+func (i *Interpreter) lookUpVariable(name Token, depth int) any {
+	if depth >= 0 {
+		return i.environment.GetAt(depth, name.Lexeme)
+	}
+	return i.globals.Get(name)
+}
+
+func (i *Interpreter) checkContext(token *Token) {
+	if err := i.ctx.Err(); err != nil {
+		panic(&RuntimeError{
+			Token:   token,
+			Message: "Execution stopped: " + err.Error() + ".",
+			cause:   err,
+		})
+	}
+}
+
+func (i *Interpreter) execute(stmt Stmt) interface{} {
+	return stmt.Accept(i)
+}
+
+// executeBlock runs statements in the given scope and restores the enclosing
+// scope afterwards, including when a RuntimeError unwinds through it. A
+// *returnValue stops the block early and is passed back to the caller.
+func (i *Interpreter) executeBlock(statements []Stmt, environment *Environment) interface{} {
+	previous := i.environment
+	defer func() {
+		i.environment = previous
+	}()
+
+	i.environment = environment
+	for _, statement := range statements {
+		if ret := i.completion(i.execute(statement)); ret != nil {
+			return ret
+		}
+	}
+	return nil
+}
+
+// completion filters a statement result down to a pending *returnValue,
+// discarding the values expression statements produce.
+func (i *Interpreter) completion(result interface{}) interface{} {
+	if ret, ok := result.(*returnValue); ok {
+		return ret
+	}
+	return nil
+}
+
 func (i *Interpreter) evaluate(expr Expr) interface{} {
 	return expr.Accept(i)
 }
 
+// arithmetic applies a binary operator to two numbers, promoting to float
+// unless both are ints.
+func (i *Interpreter) arithmetic(expr *Binary, left, right interface{}) interface{} {
+	var result interface{}
+	var err error
+	l, leftInt := left.(int64)
+	r, rightInt := right.(int64)
+	if leftInt && rightInt {
+		result, err = intArithmetic(expr.Operator.Type, l, r)
+	} else {
+		result, err = floatArithmetic(expr.Operator.Type, toFloat(left), toFloat(right))
+	}
+
+	if err != nil {
+		panic(&RuntimeError{
+			Token:   &expr.Operator,
+			Message: err.Error(),
+			Span:    ExprSpan(expr),
+		})
+	}
+	return result
+}
+
+// isEqual compares numbers by value, so 1 == 1.0.
 func (i *Interpreter) isEqual(a, b interface{}) bool {
 	if a == nil && b == nil {
 		return true
@@ -136,6 +486,14 @@ func (i *Interpreter) isEqual(a, b interface{}) bool {
 	if a == nil || b == nil {
 		return false
 	}
+	if isNumber(a) && isNumber(b) {
+		l, leftInt := a.(int64)
+		r, rightInt := b.(int64)
+		if leftInt && rightInt {
+			return l == r
+		}
+		return toFloat(a) == toFloat(b)
+	}
 	return a == b
 }
 
@@ -149,29 +507,32 @@ func (i *Interpreter) isTruthy(value interface{}) bool {
 	return true
 }
 
-func (i *Interpreter) checkNumberOperand(operator *Token, operand interface{}) {
-	if _, ok := operand.(float64); !ok {
+func (i *Interpreter) checkNumberOperand(expr Expr, operator *Token, operand interface{}) {
+	if !isNumber(operand) {
 		panic(&RuntimeError{
 			Token:   operator,
 			Message: "Operand must be a number.",
+			Span:    ExprSpan(expr),
 		})
 	}
 }
 
-func (i *Interpreter) checkNumberOperands(operator *Token, left, right interface{}) {
-	_, leftOk := left.(float64)
-	_, rightOk := right.(float64)
-	if !leftOk || !rightOk {
+func (i *Interpreter) checkNumberOperands(expr Expr, operator *Token, left, right interface{}) {
+	if !isNumber(left) || !isNumber(right) {
 		panic(&RuntimeError{
 			Token:   operator,
 			Message: "Operands must be numbers.",
+			Span:    ExprSpan(expr),
 		})
 	}
 }
 
 func (i *Interpreter) stringify(value interface{}) string {
-	if value == nil {
+	switch v := value.(type) {
+	case nil:
 		return "nil"
+	case float64:
+		return formatFloat(v)
 	}
 	return fmt.Sprintf("%v", value)
 }
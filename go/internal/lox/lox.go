@@ -2,75 +2,333 @@ package lox
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
 
 type Lox struct {
-	hadError bool
+	// PrintAst dumps the parsed AST instead of evaluating it.
+	PrintAst bool
+	// NoOptimize skips constant folding and dead branch elimination.
+	NoOptimize bool
+	// UseVM runs scripts on the bytecode VM instead of the tree-walking
+	// Interpreter. The two backends keep separate globals.
+	UseVM bool
+	// Trace prints the VM's stack and each instruction to stdout as it
+	// runs. It only applies with UseVM.
+	Trace bool
+	// GCStress makes the VM collect garbage before every allocation. It
+	// only applies with UseVM, the Interpreter leaves memory to Go.
+	GCStress bool
+	// HeapGrowFactor sets how far the VM's heap grows between collections,
+	// DefaultHeapGrowFactor when zero. It only applies with UseVM.
+	HeapGrowFactor float64
+
+	stdout      io.Writer
+	stderr      io.Writer
+	interpreter *Interpreter
+	vm          *VM
+	repl        bool
 }
 
-func NewLox() *Lox {
+// NewLox creates a driver whose print output goes to stdout and whose
+// diagnostics and runtime errors go to stderr. Globals persist across runs.
+func NewLox(stdout, stderr io.Writer) *Lox {
 	return &Lox{
-		hadError: false,
+		stdout:      stdout,
+		stderr:      stderr,
+		interpreter: NewInterpreter(stdout),
+		vm:          NewVM(stdout),
 	}
 }
 
-func (l *Lox) RunFile(path string) {
-	bytes, err := os.ReadFile(path)
+// DefineNative registers a Go function callable from scripts as name.
+func (l *Lox) DefineNative(name string, arity int, fn NativeFn) {
+	l.interpreter.DefineNative(name, arity, fn)
+	l.vm.DefineNative(name, arity, fn)
+}
+
+// RunFile runs the script at path. It returns ErrStatic if the source had
+// static errors and a *RuntimeError if execution failed.
+func (l *Lox) RunFile(path string) error {
+	file, err := os.Open(path)
 	if err != nil {
-		fmt.Println("Error reading file: ", err.Error())
-		os.Exit(1)
-	}
-	l.run(string(bytes))
-	if l.hadError {
-		os.Exit(65)
+		return fmt.Errorf("reading file: %w", err)
 	}
+	defer file.Close()
+
+	_, _, err = l.RunReader(context.Background(), path, file)
+	return err
 }
 
-func (l *Lox) RunPrompt() {
-	reader := bufio.NewReader(os.Stdin)
+func (l *Lox) RunPrompt(in io.Reader) {
+	reader := bufio.NewReader(in)
+	l.repl = true
+	defer func() {
+		l.repl = false
+	}()
 
 	for {
-		fmt.Print("> ")
+		fmt.Fprint(l.stdout, "> ")
 		line, err := reader.ReadString('\n')
 		if err != nil {
 			break
 		}
 
-		l.run(strings.TrimSpace(line))
-		l.hadError = false
+		// Errors were already reported, the session carries on
+		l.RunReader(context.Background(), "<stdin>", strings.NewReader(strings.TrimSpace(line)))
 	}
 }
 
-func (l *Lox) run(source string) {
-	scanner := NewScanner(source, l)
-	tokens := scanner.scanTokens()
+// Run scans, parses, resolves and interprets source. It returns the value of
+// the final statement when that is an expression statement, the static
+// diagnostics if there were any, and ErrStatic or a *RuntimeError on failure.
+func (l *Lox) Run(ctx context.Context, source string) (any, []Diagnostic, error) {
+	return l.RunReader(ctx, "<script>", strings.NewReader(source))
+}
 
-	// for _, token := range tokens {
-	//     fmt.Println(token.String())
-	// }
+// RunReader is Run for source read from r, which is scanned as it arrives
+// rather than read up front. name labels the source in rendered
+// diagnostics. A copy of the source read is still kept until the run ends,
+// so that errors can quote it.
+func (l *Lox) RunReader(ctx context.Context, name string, r io.Reader) (any, []Diagnostic, error) {
+	reporter := NewStreamReporter(l.stderr, name)
+	statements, err := l.parse(reporter, reporter.Source(r))
+	if err != nil {
+		return nil, reporter.Diagnostics(), err
+	}
+
+	if l.PrintAst {
+		astPrinter := NewAstPrinter()
+		for _, stmt := range statements {
+			fmt.Fprintf(l.stdout, "AST: %s\n", astPrinter.PrintStmt(stmt))
+		}
+		return nil, nil, nil
+	}
 
-	parser := NewParser(tokens, l)
-	for !parser.isAtEnd() {
-		expr, err := parser.Parse()
-		if err != nil || l.hadError {
-			return
+	var value any
+	if l.UseVM {
+		value, err = l.execute(ctx, reporter, statements)
+		if err == ErrStatic {
+			return nil, reporter.Diagnostics(), err
 		}
-		if expr != nil {
-			astPrinter := NewAstPrinter()
-			fmt.Printf("AST: %s\n", astPrinter.Print(expr))
+	} else {
+		value, err = l.interpreter.Interpret(ctx, statements)
+	}
+	if err != nil {
+		if runtimeErr, ok := err.(*RuntimeError); ok {
+			fmt.Fprint(l.stderr, reporter.render(runtimeErr.Diagnostic()))
 		}
+		return nil, nil, err
+	}
+
+	if len(statements) == 0 {
+		return nil, nil, nil
+	}
+	if _, ok := statements[len(statements)-1].(*Expression); !ok {
+		return nil, nil, nil
+	}
+
+	// Echo bare expressions back in the REPL
+	if l.repl {
+		fmt.Fprintln(l.stdout, l.interpreter.stringify(value))
+	}
+	return value, nil, nil
+}
+
+// CompileFile compiles the script at path to bytecode without running it.
+// It returns ErrStatic if the source had static errors.
+func (l *Lox) CompileFile(path string) (*ObjFunction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	defer file.Close()
+
+	reporter := NewStreamReporter(l.stderr, path)
+	statements, err := l.parse(reporter, reporter.Source(file))
+	if err != nil {
+		return nil, err
+	}
+	return l.compile(reporter, statements)
+}
+
+// ParseFile returns the syntax tree of the script at path as the Parser
+// built it, before resolving or optimizing. It returns ErrStatic if the
+// source had syntax errors.
+func (l *Lox) ParseFile(path string) ([]Stmt, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	defer file.Close()
+
+	reporter := NewStreamReporter(l.stderr, path)
+	parser := NewParser(NewScanner(reporter.Source(file), reporter), reporter)
+	statements, _ := parser.Parse()
+	reporter.sourceDone()
+	if err := parser.Err(); err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	if reporter.HadError() {
+		return nil, ErrStatic
 	}
+	return statements, nil
 }
 
-func (l *Lox) error(line int, message string) error {
-	return l.report(line, "", message)
+// ScanFile returns every token in the script at path, ending with EOF. If
+// the source had lexical errors they are reported, the tokens around them
+// are still returned and so is ErrStatic.
+func (l *Lox) ScanFile(path string) ([]Token, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	defer file.Close()
+
+	reporter := NewStreamReporter(l.stderr, path)
+	scanner := NewScanner(reporter.Source(file), reporter)
+	tokens := []Token{}
+	for {
+		token, err := scanner.Next()
+		if err != nil {
+			return nil, fmt.Errorf("reading file: %w", err)
+		}
+		tokens = append(tokens, token)
+		if token.Type == EOF {
+			break
+		}
+	}
+	reporter.sourceDone()
+
+	if reporter.HadError() {
+		return tokens, ErrStatic
+	}
+	return tokens, nil
 }
 
-func (l *Lox) report(line int, where, message string) error {
-	l.hadError = true
-	fmt.Fprintf(os.Stderr, "[line %d] Error %s: %s\n", line, where, message)
-	return fmt.Errorf(message)
+// WriteCompiledFile compiles the script at in and saves its bytecode to out
+// in the .loxc format.
+func (l *Lox) WriteCompiledFile(in, out string) error {
+	function, err := l.CompileFile(in)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("creating file: %w", err)
+	}
+	if err := WriteBytecode(file, function); err != nil {
+		file.Close()
+		return fmt.Errorf("writing file: %w", err)
+	}
+	return file.Close()
+}
+
+// RunCompiledFile runs a .loxc file on the VM. It returns an error wrapping
+// ErrInvalidBytecode if the file can't be loaded and a *RuntimeError if
+// execution failed.
+func (l *Lox) RunCompiledFile(path string) error {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+
+	function, err := l.vm.ReadBytecode(bytes)
+	if err != nil {
+		return err
+	}
+
+	if err := l.interpretBytecode(function); err != nil {
+		if runtimeErr, ok := err.(*RuntimeError); ok {
+			// Without the source only the position can be shown
+			fmt.Fprint(l.stderr, runtimeErr.Diagnostic().Render(path, ""))
+		}
+		return err
+	}
+	return nil
+}
+
+// interpretBytecode runs a loaded script. Loading checks every operand
+// except stack slots, so a crafted file can still fault the VM, which is
+// reported as invalid bytecode rather than crashing the host.
+func (l *Lox) interpretBytecode(function *ObjFunction) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.vm.resetStack()
+			err = fmt.Errorf("%w: %v", ErrInvalidBytecode, r)
+		}
+	}()
+
+	l.configureVM()
+	_, err = l.vm.Interpret(context.Background(), function)
+	return err
+}
+
+// parse scans, parses, resolves and optimizes source, which should be read
+// through reporter.
+func (l *Lox) parse(reporter *Reporter, source io.Reader) ([]Stmt, error) {
+	parser := NewParser(NewScanner(source, reporter), reporter)
+	statements, _ := parser.Parse()
+	reporter.sourceDone()
+	if err := parser.Err(); err != nil {
+		return nil, fmt.Errorf("reading source: %w", err)
+	}
+	if reporter.HadError() {
+		return nil, ErrStatic
+	}
+
+	resolver := NewResolver(reporter)
+	resolver.Resolve(statements)
+	if reporter.HadError() {
+		return nil, ErrStatic
+	}
+
+	// After resolving so code that gets dropped is still checked. --ast
+	// shows the tree as parsed.
+	if !l.NoOptimize && !l.PrintAst {
+		statements = NewOptimizer().Optimize(statements)
+	}
+	return statements, nil
+}
+
+func (l *Lox) compile(reporter *Reporter, statements []Stmt) (*ObjFunction, error) {
+	compiler := NewCompiler(l.vm, reporter)
+	function := compiler.Compile(statements)
+	if reporter.HadError() {
+		return nil, ErrStatic
+	}
+	return function, nil
+}
+
+// execute compiles statements and runs them on the VM.
+func (l *Lox) execute(ctx context.Context, reporter *Reporter, statements []Stmt) (any, error) {
+	function, err := l.compile(reporter, statements)
+	if err != nil {
+		return nil, err
+	}
+
+	l.configureVM()
+	value, err := l.vm.Interpret(ctx, function)
+	if err != nil {
+		return nil, err
+	}
+	return value.Any(), nil
+}
+
+// configureVM applies the debugging and collector options to the VM.
+func (l *Lox) configureVM() {
+	l.vm.Trace = nil
+	if l.Trace {
+		l.vm.Trace = l.stdout
+	}
+	l.vm.GCStress = l.GCStress
+	l.vm.HeapGrowFactor = l.HeapGrowFactor
+	if l.HeapGrowFactor == 0 {
+		l.vm.HeapGrowFactor = DefaultHeapGrowFactor
+	}
 }
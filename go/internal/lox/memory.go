@@ -0,0 +1,217 @@
+package lox
+
+import "unsafe"
+
+// DefaultHeapGrowFactor is how much the heap may grow past what survived a
+// collection before the next one runs.
+const DefaultHeapGrowFactor = 2
+
+// initialNextGC is the heap size that triggers the first collection.
+const initialNextGC = 1 << 20
+
+// fieldSize is what one field or method entry adds to its object's size.
+const fieldSize = int(unsafe.Sizeof(Value{})) + int(unsafe.Sizeof(&ObjString{}))
+
+// GCStats reports the state of the VM's heap. Sizes are the collector's own
+// estimates, not what Go's allocator used.
+type GCStats struct {
+	BytesAllocated int
+	NextGC         int
+	Collections    int
+	BytesFreed     int
+	Objects        int
+}
+
+// GCStats returns the heap statistics so far.
+func (vm *VM) GCStats() GCStats {
+	return GCStats{
+		BytesAllocated: vm.bytesAllocated,
+		NextGC:         vm.nextGC,
+		Collections:    vm.collections,
+		BytesFreed:     vm.bytesFreed,
+		Objects:        len(vm.objects),
+	}
+}
+
+// allocate registers a new object of size bytes with the heap, collecting
+// first if the heap has outgrown its threshold. The object itself isn't a
+// root yet, so anything it points at must already be reachable.
+func (vm *VM) allocate(obj Obj, size int) {
+	if vm.GCStress || vm.bytesAllocated+size > vm.nextGC {
+		vm.collectGarbage()
+	}
+
+	obj.header().size = size
+	vm.bytesAllocated += size
+	vm.objects = append(vm.objects, obj)
+}
+
+// grow accounts for an object that got bigger after it was allocated.
+func (vm *VM) grow(obj Obj, size int) {
+	obj.header().size += size
+	vm.bytesAllocated += size
+}
+
+func (vm *VM) collectGarbage() {
+	before := vm.bytesAllocated
+
+	vm.markRoots()
+	vm.traceReferences()
+	vm.removeWhiteStrings()
+	vm.sweep()
+
+	growFactor := vm.HeapGrowFactor
+	if growFactor < 1 {
+		growFactor = DefaultHeapGrowFactor
+	}
+	vm.nextGC = max(int(float64(vm.bytesAllocated)*growFactor), initialNextGC)
+	vm.collections++
+	vm.bytesFreed += before - vm.bytesAllocated
+}
+
+// Marking
+func (vm *VM) markRoots() {
+	for _, value := range vm.stack {
+		vm.markValue(value)
+	}
+	for idx := range vm.frameCount {
+		vm.markObject(vm.frames[idx].closure)
+	}
+	for upvalue := vm.openUpvalues; upvalue != nil; upvalue = upvalue.next {
+		vm.markObject(upvalue)
+	}
+	for name, value := range vm.globals {
+		vm.markObject(name)
+		vm.markValue(value)
+	}
+	if vm.compiler != nil {
+		for compiler := vm.compiler.current; compiler != nil; compiler = compiler.enclosing {
+			vm.markObject(compiler.function)
+		}
+	}
+	vm.markObject(vm.initString)
+	if vm.gcStatsClass != nil {
+		vm.markObject(vm.gcStatsClass)
+	}
+}
+
+func (vm *VM) markValue(value Value) {
+	if value.Type == VAL_OBJ {
+		vm.markObject(value.obj)
+	}
+}
+
+// markObject turns an object gray, it turns black once traceReferences has
+// marked everything it refers to.
+func (vm *VM) markObject(obj Obj) {
+	header := obj.header()
+	if header.isMarked {
+		return
+	}
+	header.isMarked = true
+	vm.grayStack = append(vm.grayStack, obj)
+}
+
+func (vm *VM) traceReferences() {
+	for len(vm.grayStack) > 0 {
+		obj := vm.grayStack[len(vm.grayStack)-1]
+		vm.grayStack = vm.grayStack[:len(vm.grayStack)-1]
+		vm.blackenObject(obj)
+	}
+}
+
+func (vm *VM) blackenObject(obj Obj) {
+	switch o := obj.(type) {
+	case *ObjFunction:
+		// The script has no name
+		if o.Name != nil {
+			vm.markObject(o.Name)
+		}
+		for _, constant := range o.Chunk.Constants {
+			vm.markValue(constant)
+		}
+	case *ObjClosure:
+		vm.markObject(o.Function)
+		for _, upvalue := range o.Upvalues {
+			// Still nil while OP_CLOSURE is capturing them
+			if upvalue != nil {
+				vm.markObject(upvalue)
+			}
+		}
+	case *ObjUpvalue:
+		vm.markValue(o.closed)
+	case *ObjClass:
+		vm.markObject(o.Name)
+		for name, method := range o.Methods {
+			vm.markObject(name)
+			vm.markObject(method)
+		}
+	case *ObjInstance:
+		vm.markObject(o.Class)
+		for name, value := range o.Fields {
+			vm.markObject(name)
+			vm.markValue(value)
+		}
+	case *ObjBoundMethod:
+		vm.markValue(o.Receiver)
+		vm.markObject(o.Method)
+	}
+}
+
+// Sweeping
+
+// removeWhiteStrings drops unreachable strings from the intern table, which
+// holds its strings weakly.
+func (vm *VM) removeWhiteStrings() {
+	for chars, str := range vm.strings {
+		if !str.isMarked {
+			delete(vm.strings, chars)
+		}
+	}
+}
+
+// sweep forgets every unmarked object, leaving Go to reclaim its memory,
+// and clears the marks of the survivors for the next collection.
+func (vm *VM) sweep() {
+	live := vm.objects[:0]
+	for _, obj := range vm.objects {
+		header := obj.header()
+		if header.isMarked {
+			header.isMarked = false
+			live = append(live, obj)
+			continue
+		}
+		vm.bytesAllocated -= header.size
+	}
+
+	clear(vm.objects[len(live):])
+	vm.objects = live
+}
+
+// gcStatsInstance builds the instance gcStats() returns to scripts.
+func (vm *VM) gcStatsInstance() *ObjInstance {
+	if vm.gcStatsClass == nil {
+		name := vm.copyString("GCStats")
+		vm.push(objValue(name))
+		vm.gcStatsClass = vm.newClass(name)
+		vm.pop()
+	}
+
+	// Keep the instance reachable while its field names are allocated
+	instance := vm.newInstance(vm.gcStatsClass)
+	vm.push(objValue(instance))
+	defer vm.pop()
+
+	stats := vm.GCStats()
+	vm.setField(instance, "bytesAllocated", intValue(int64(stats.BytesAllocated)))
+	vm.setField(instance, "collections", intValue(int64(stats.Collections)))
+	return instance
+}
+
+func (vm *VM) setField(instance *ObjInstance, name string, value Value) {
+	key := vm.copyString(name)
+	if _, ok := instance.Fields[key]; !ok {
+		vm.grow(instance, fieldSize)
+	}
+	instance.Fields[key] = value
+}
@@ -0,0 +1,110 @@
+package lox
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"time"
+)
+
+// NativeFn is the Go implementation behind a native function. A non-nil
+// error is reported to the script as a RuntimeError at the call site.
+type NativeFn func(arguments []any) (any, error)
+
+type NativeFunction struct {
+	name  string
+	arity int
+	fn    NativeFn
+}
+
+func NewNativeFunction(name string, arity int, fn NativeFn) *NativeFunction {
+	return &NativeFunction{
+		name:  name,
+		arity: arity,
+		fn:    fn,
+	}
+}
+
+func (n *NativeFunction) Arity() int {
+	return n.arity
+}
+
+// Call satisfies LoxCallable. The Interpreter calls invoke directly so
+// errors point at the call site.
+func (n *NativeFunction) Call(interpreter *Interpreter, arguments []any) any {
+	value, err := n.invoke(arguments)
+	if err != nil {
+		panic(&RuntimeError{Message: err.Error()})
+	}
+	return value
+}
+
+// invoke runs the Go function and converts its result with nativeResult.
+func (n *NativeFunction) invoke(arguments []any) (any, error) {
+	value, err := n.fn(arguments)
+	if err != nil {
+		return nil, err
+	}
+	return nativeResult(value)
+}
+
+// nativeResult turns any Go integer a native returns into the int64 Lox
+// uses, and any float into a float64. Both backends convert through here so
+// a native gives them the same value.
+func nativeResult(value any) (any, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint:
+		return nativeUint(uint64(v))
+	case uint64:
+		return nativeUint(v)
+	case uintptr:
+		return nativeUint(uint64(v))
+	case float32:
+		return float64(v), nil
+	}
+	return value, nil
+}
+
+func nativeUint(v uint64) (any, error) {
+	if v > math.MaxInt64 {
+		return nil, fmt.Errorf("Native function returned %d, which is too large for an int.", v)
+	}
+	return int64(v), nil
+}
+
+func (n *NativeFunction) String() string {
+	return "<native fn " + n.name + ">"
+}
+
+// defineNatives installs the natives every Interpreter starts with.
+func (i *Interpreter) defineNatives() {
+	i.DefineNative("clock", 0, func(arguments []any) (any, error) {
+		return float64(time.Now().UnixNano()) / float64(time.Second), nil
+	})
+	// There is no Lox heap here, so this reports Go's whole heap and its
+	// collections. The VM's gcStats counts only its own objects, by its own
+	// size estimates, so the two backends' figures aren't comparable.
+	i.DefineNative("gcStats", 0, func(arguments []any) (any, error) {
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+
+		stats := NewLoxInstance(NewLoxClass("GCStats", nil, map[string]*LoxFunction{}))
+		stats.fields["bytesAllocated"] = int64(memStats.HeapAlloc)
+		stats.fields["collections"] = int64(memStats.NumGC)
+		return stats, nil
+	})
+}
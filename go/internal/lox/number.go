@@ -0,0 +1,119 @@
+package lox
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Lox numbers are int64 when written without a decimal point and float64
+// otherwise. Arithmetic on two ints stays an int, mixing in a float
+// promotes the int.
+
+var (
+	errIntegerOverflow = errors.New("Integer overflow.")
+	errDivisionByZero  = errors.New("Division by zero.")
+)
+
+func isNumber(value any) bool {
+	switch value.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+// toFloat converts a number, int or float, to a float.
+func toFloat(value any) float64 {
+	if n, ok := value.(int64); ok {
+		return float64(n)
+	}
+	return value.(float64)
+}
+
+// intArithmetic applies +, -, *, / or % to two ints. Division truncates.
+// It fails on overflow instead of wrapping.
+func intArithmetic(op TokenType, a, b int64) (int64, error) {
+	switch op {
+	case PLUS:
+		sum := a + b
+		if (a^sum)&(b^sum) < 0 {
+			return 0, errIntegerOverflow
+		}
+		return sum, nil
+	case MINUS:
+		difference := a - b
+		if (a^b)&(a^difference) < 0 {
+			return 0, errIntegerOverflow
+		}
+		return difference, nil
+	case STAR:
+		if a == 0 || b == 0 {
+			return 0, nil
+		}
+		product := a * b
+		if product/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+			return 0, errIntegerOverflow
+		}
+		return product, nil
+	case SLASH, PERCENT:
+		if b == 0 {
+			return 0, errDivisionByZero
+		}
+		if op == PERCENT {
+			return a % b, nil
+		}
+		if a == math.MinInt64 && b == -1 {
+			return 0, errIntegerOverflow
+		}
+		return a / b, nil
+	}
+	panic(fmt.Sprintf("unexpected arithmetic operator %s", op))
+}
+
+func floatArithmetic(op TokenType, a, b float64) (float64, error) {
+	switch op {
+	case PLUS:
+		return a + b, nil
+	case MINUS:
+		return a - b, nil
+	case STAR:
+		return a * b, nil
+	case SLASH, PERCENT:
+		if b == 0 {
+			return 0, errDivisionByZero
+		}
+		if op == PERCENT {
+			return math.Mod(a, b), nil
+		}
+		return a / b, nil
+	}
+	panic(fmt.Sprintf("unexpected arithmetic operator %s", op))
+}
+
+// compareNumbers applies a comparison operator to two ints or two floats.
+func compareNumbers[T int64 | float64](op TokenType, a, b T) bool {
+	switch op {
+	case GREATER:
+		return a > b
+	case GREATER_EQUAL:
+		return a >= b
+	case LESS:
+		return a < b
+	case LESS_EQUAL:
+		return a <= b
+	}
+	panic(fmt.Sprintf("unexpected comparison operator %s", op))
+}
+
+// formatFloat prints integral floats with a trailing ".0" so they read
+// differently from ints.
+func formatFloat(f float64) string {
+	text := fmt.Sprintf("%v", f)
+	// Already has a fraction or exponent, or is NaN or +Inf
+	if strings.ContainsAny(text, ".eIN") {
+		return text
+	}
+	return text + ".0"
+}
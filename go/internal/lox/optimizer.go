@@ -0,0 +1,265 @@
+package lox
+
+import "io"
+
+// Optimizer rewrites a resolved AST in place, folding operations on
+// literals, dropping branches whose condition is a literal and removing
+// double negation where only truthiness matters. Nodes the Resolver keys
+// on are never replaced, so its depths stay valid.
+type Optimizer struct {
+	// evaluator computes folded values so they match the Interpreter's
+	evaluator *Interpreter
+}
+
+func NewOptimizer() *Optimizer {
+	return &Optimizer{
+		evaluator: NewInterpreter(io.Discard),
+	}
+}
+
+func (o *Optimizer) Optimize(statements []Stmt) []Stmt {
+	for idx, statement := range statements {
+		statements[idx] = o.stmt(statement)
+	}
+	return statements
+}
+
+// Statements
+func (o *Optimizer) VisitBlockStmt(stmt *Block) interface{} {
+	o.Optimize(stmt.Statements)
+	return stmt
+}
+
+func (o *Optimizer) VisitClassStmt(stmt *Class) interface{} {
+	for _, method := range stmt.Methods {
+		o.Optimize(method.Body)
+	}
+	return stmt
+}
+
+func (o *Optimizer) VisitExpressionStmt(stmt *Expression) interface{} {
+	stmt.Expression = o.expr(stmt.Expression)
+	return stmt
+}
+
+func (o *Optimizer) VisitFunctionStmt(stmt *Function) interface{} {
+	o.Optimize(stmt.Body)
+	return stmt
+}
+
+func (o *Optimizer) VisitIfStmt(stmt *If) interface{} {
+	stmt.Condition = o.condition(stmt.Condition)
+	stmt.ThenBranch = o.stmt(stmt.ThenBranch)
+	if stmt.ElseBranch != nil {
+		stmt.ElseBranch = o.stmt(stmt.ElseBranch)
+	}
+
+	condition, ok := stmt.Condition.(*Literal)
+	if !ok {
+		return stmt
+	}
+	if o.evaluator.isTruthy(condition.Value) {
+		return stmt.ThenBranch
+	}
+	if stmt.ElseBranch != nil {
+		return stmt.ElseBranch
+	}
+	return NewBlock([]Stmt{})
+}
+
+func (o *Optimizer) VisitPrintStmt(stmt *Print) interface{} {
+	stmt.Expression = o.expr(stmt.Expression)
+	return stmt
+}
+
+func (o *Optimizer) VisitReturnStmt(stmt *Return) interface{} {
+	if stmt.Value != nil {
+		stmt.Value = o.expr(stmt.Value)
+	}
+	return stmt
+}
+
+func (o *Optimizer) VisitVarStmt(stmt *Var) interface{} {
+	if stmt.Initializer != nil {
+		stmt.Initializer = o.expr(stmt.Initializer)
+	}
+	return stmt
+}
+
+func (o *Optimizer) VisitWhileStmt(stmt *While) interface{} {
+	stmt.Condition = o.condition(stmt.Condition)
+	stmt.Body = o.stmt(stmt.Body)
+
+	if condition, ok := stmt.Condition.(*Literal); ok && !o.evaluator.isTruthy(condition.Value) {
+		return NewBlock([]Stmt{})
+	}
+	return stmt
+}
+
+// Expressions
+func (o *Optimizer) VisitAssignExpr(expr *Assign) interface{} {
+	expr.Value = o.expr(expr.Value)
+	return expr
+}
+
+func (o *Optimizer) VisitBinaryExpr(expr *Binary) interface{} {
+	expr.Left = o.expr(expr.Left)
+	expr.Right = o.expr(expr.Right)
+
+	_, leftOk := expr.Left.(*Literal)
+	_, rightOk := expr.Right.(*Literal)
+	if leftOk && rightOk {
+		return o.fold(expr)
+	}
+	return expr
+}
+
+func (o *Optimizer) VisitCallExpr(expr *Call) interface{} {
+	expr.Callee = o.expr(expr.Callee)
+	for idx, argument := range expr.Arguments {
+		expr.Arguments[idx] = o.expr(argument)
+	}
+	return expr
+}
+
+func (o *Optimizer) VisitGetExpr(expr *Get) interface{} {
+	expr.Object = o.expr(expr.Object)
+	return expr
+}
+
+func (o *Optimizer) VisitGroupingExpr(expr *Grouping) interface{} {
+	expr.Expression = o.expr(expr.Expression)
+	if literal, ok := expr.Expression.(*Literal); ok {
+		// Still covering the parentheses
+		return NewLiteral(literal.Value, literal.Token, ExprSpan(expr))
+	}
+	return expr
+}
+
+func (o *Optimizer) VisitLiteralExpr(expr *Literal) interface{} {
+	return expr
+}
+
+// VisitLogicalExpr picks the operand a literal left side decides on
+func (o *Optimizer) VisitLogicalExpr(expr *Logical) interface{} {
+	expr.Left = o.expr(expr.Left)
+	expr.Right = o.expr(expr.Right)
+
+	left, ok := expr.Left.(*Literal)
+	if !ok {
+		return expr
+	}
+	if o.evaluator.isTruthy(left.Value) == (expr.Operator.Type == OR) {
+		return left
+	}
+	return expr.Right
+}
+
+func (o *Optimizer) VisitSetExpr(expr *Set) interface{} {
+	expr.Object = o.expr(expr.Object)
+	expr.Value = o.expr(expr.Value)
+	return expr
+}
+
+func (o *Optimizer) VisitSuperExpr(expr *Super) interface{} {
+	return expr
+}
+
+func (o *Optimizer) VisitThisExpr(expr *This) interface{} {
+	return expr
+}
+
+func (o *Optimizer) VisitUnaryExpr(expr *Unary) interface{} {
+	if expr.Operator.Type == BANG {
+		expr.Right = o.condition(expr.Right)
+	} else {
+		expr.Right = o.expr(expr.Right)
+	}
+
+	if _, ok := expr.Right.(*Literal); ok {
+		return o.fold(expr)
+	}
+	return expr
+}
+
+func (o *Optimizer) VisitVariableExpr(expr *Variable) interface{} {
+	return expr
+}
+
+// Helpers
+func (o *Optimizer) stmt(stmt Stmt) Stmt {
+	return stmt.Accept(o).(Stmt)
+}
+
+func (o *Optimizer) expr(expr Expr) Expr {
+	return expr.Accept(o).(Expr)
+}
+
+// condition optimizes an expression only used for its truthiness, where
+// !!x can become x.
+func (o *Optimizer) condition(expr Expr) Expr {
+	expr = o.expr(expr)
+	for {
+		outer, ok := ungroup(expr).(*Unary)
+		if !ok || outer.Operator.Type != BANG {
+			return expr
+		}
+		inner, ok := ungroup(outer.Right).(*Unary)
+		if !ok || inner.Operator.Type != BANG {
+			return expr
+		}
+		expr = inner.Right
+	}
+}
+
+func ungroup(expr Expr) Expr {
+	for {
+		grouping, ok := expr.(*Grouping)
+		if !ok {
+			return expr
+		}
+		expr = grouping.Expression
+	}
+}
+
+// fold evaluates an operation on literals into a literal. Operations that
+// fail, like dividing by zero, are kept so they still fail at runtime.
+func (o *Optimizer) fold(expr Expr) (folded Expr) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(*RuntimeError); !ok {
+				panic(r)
+			}
+			folded = expr
+		}
+	}()
+
+	value := o.evaluator.evaluate(expr)
+	// The literal keeps the span of what it replaces, so errors it ends up
+	// in underline the same source as without optimizing
+	span := ExprSpan(expr)
+	return NewLiteral(value, o.literalToken(value, span), span)
+}
+
+// literalToken makes a token for a folded value starting where span does.
+func (o *Optimizer) literalToken(value any, span Span) Token {
+	var tokenType TokenType
+	lexeme := o.evaluator.stringify(value)
+	switch v := value.(type) {
+	case nil:
+		tokenType = NIL
+	case bool:
+		tokenType = FALSE
+		if v {
+			tokenType = TRUE
+		}
+	case int64, float64:
+		tokenType = NUMBER
+	case string:
+		tokenType = STRING
+		lexeme = "\"" + v + "\""
+	}
+	token := NewToken(tokenType, lexeme, value, span.Line, span.Column, span.Start)
+	token.Source = span.Source
+	return *token
+}
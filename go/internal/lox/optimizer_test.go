@@ -0,0 +1,94 @@
+package lox
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// optimize returns the optimized statements of source, printed one per line.
+func optimize(t *testing.T, source string) string {
+	t.Helper()
+	l := NewLox(io.Discard, io.Discard)
+	reporter := NewReporter(io.Discard, "<test>", source)
+	statements, err := l.parse(reporter, strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	printer := NewAstPrinter()
+	for _, stmt := range statements {
+		lines = append(lines, printer.PrintStmt(stmt))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestOptimizerKeepsSemantics(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"int division", "print 7 / 2;", "(print 3)"},
+		{"float division", "print 7 / 2.0;", "(print 3.5)"},
+		{"string operand", `print "a" - 1;`, `(print (- "a" 1))`},
+		{"int division by zero", "print 1 / 0;", "(print (/ 1 0))"},
+		{"float division by zero", "print 1.0 / 0;", "(print (/ 1.0 0))"},
+		{"negated string", `print -("a" + "b");`, `(print (- "ab"))`},
+		{"double negation in a condition", "var x = 1;\nif (!!x) print 1;", "(var x = 1)\n(if x (print 1))"},
+		{"grouped double negation", "var x = 1;\nwhile (!(!x)) x = nil;", "(var x = 1)\n(while x (; (= x nil)))"},
+		{"double negation under not", "var x = 1;\nprint !!!x;", "(var x = 1)\n(print (! x))"},
+		{"double negation as a value", "var x = 1;\nprint !!x;", "(var x = 1)\n(print (! (! x)))"},
+		{"double negation as a logical operand", "var x = 1;\nif (!!x or x) print 1;", "(var x = 1)\n(if (or (! (! x)) x) (print 1))"},
+		{"true condition", `if (true) print "a"; else print "b";`, `(print "a")`},
+		{"false condition", `if (nil) print "a"; else print "b";`, `(print "b")`},
+		{"false condition without else", `if (0 == 1) print "a";`, "(block)"},
+		{"false loop", `while (false) print "a";`, "(block)"},
+		{"decided logical", "var x = 1;\nprint false and x;\nprint 1 or x;", "(var x = 1)\n(print false)\n(print 1)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := optimize(t, test.source); got != test.want {
+				t.Errorf("optimized to\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+// TestOptimizerMatchesUnoptimized runs each script with and without the
+// Optimizer on both backends, which must all print the same.
+func TestOptimizerMatchesUnoptimized(t *testing.T) {
+	scripts := []string{
+		"print 7 / 2; print 7 / 2.0; print 7.0 / 2; print 2 * 3 - 1 % 4;",
+		`print "a" - 1;`,
+		"print 1 / 0;",
+		"print 1.0 / 0;",
+		`print -("a" + "b");`,
+		"print !!3; print !!nil; print !!!0;",
+		"var x = 0;\nwhile (!!(x < 3)) x = x + 1;\nprint x;",
+		"fun f() { print \"called\"; return true; }\nif (true) print 1; else f();\nif (false) f(); else print 2;\nwhile (false) f();\nprint false and f();\nprint true or f();\nprint nil or f();",
+		"if (1 > 2) { var unused = 1 / 0; } else { print \"else\"; }\nprint \"a\" + \"b\" == \"ab\";",
+	}
+
+	for _, script := range scripts {
+		var want string
+		for _, useVM := range []bool{false, true} {
+			for _, noOptimize := range []bool{true, false} {
+				var output strings.Builder
+				l := NewLox(&output, &output)
+				l.UseVM = useVM
+				l.NoOptimize = noOptimize
+				l.Run(context.Background(), script)
+
+				if want == "" {
+					want = output.String()
+				} else if output.String() != want {
+					t.Errorf("UseVM=%v NoOptimize=%v ran %q and printed\n%s\nwant\n%s", useVM, noOptimize, script, output.String(), want)
+				}
+			}
+		}
+	}
+}
@@ -4,47 +4,328 @@ import (
 	"fmt"
 )
 
+// maxArguments caps parameter and argument lists of calls
+const maxArguments = 255
+
+// TokenSource hands the Parser its tokens one at a time, like the Scanner
+// does. Once the input is exhausted it keeps returning EOF.
+type TokenSource interface {
+	Next() (Token, error)
+}
+
+// Parser pulls tokens from its source as it needs them. It only ever looks
+// one token ahead, so it keeps just that and the one before it.
 type Parser struct {
-	tokens  []Token
-	current int
-	lox     *Lox
+	tokens        TokenSource
+	currentToken  Token
+	previousToken Token
+	// err is the first error from tokens, after which it acts as if it
+	// had reached EOF
+	err      error
+	reporter *Reporter
+	errors   []*ParseError
 }
 
+// ParseError is a syntax error at Token. Grammar rules panic with it to
+// unwind to the enclosing declaration, which synchronizes and carries on.
 type ParseError struct {
-	msg string
+	Token      Token
+	Diagnostic Diagnostic
 }
 
-func NewParser(tokens []Token, l *Lox) *Parser {
+func NewParser(tokens TokenSource, reporter *Reporter) *Parser {
 	return &Parser{
-		tokens:  tokens,
-		current: 0,
-		lox:     l,
+		tokens:   tokens,
+		reporter: reporter,
+		errors:   []*ParseError{},
+	}
+}
+
+func NewParseError(token Token, diagnostic Diagnostic) *ParseError {
+	return &ParseError{
+		Token:      token,
+		Diagnostic: diagnostic,
 	}
 }
 
-func NewParseError(msg string) *ParseError {
-	return &ParseError{msg: msg}
+func (e *ParseError) Error() string {
+	return e.Diagnostic.String()
+}
+
+// Err returns the error that stopped the Parser reading tokens, if any.
+// Parse treats it as the end of the input.
+func (p *Parser) Err() error {
+	return p.err
 }
 
-func (p *Parser) Parse() (Expr, error) {
+// Parse parses the whole program, recovering at statement boundaries after
+// each syntax error. It returns the statements that parsed cleanly and
+// every error found, in source order.
+func (p *Parser) Parse() ([]Stmt, []*ParseError) {
+	p.currentToken = p.read()
+	statements := []Stmt{}
+	for !p.isAtEnd() {
+		if stmt := p.declaration(); stmt != nil {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements, p.errors
+}
+
+// Statement parsing methods
+
+// declaration returns nil when it had to discard tokens to recover from a
+// syntax error.
+func (p *Parser) declaration() (stmt Stmt) {
 	defer func() {
 		if r := recover(); r != nil {
-			p.lox.hadError = true
+			if _, ok := r.(*ParseError); !ok {
+				panic(r)
+			}
+			p.synchronize()
+			stmt = nil
 		}
 	}()
-	expr := p.expression()
 
-	// Always consume atleast one token to move forward
-	p.advance()
-	if p.lox.hadError {
-		return nil, fmt.Errorf("parse error")
+	if p.match(CLASS) {
+		return p.classDeclaration()
+	}
+	if p.match(FUN) {
+		return p.function("function")
+	}
+	if p.match(VAR) {
+		return p.varDeclaration()
+	}
+	return p.statement()
+}
+
+func (p *Parser) classDeclaration() Stmt {
+	name := p.consume(IDENTIFIER, "Expect class name.")
+
+	var superclass *Variable
+	if p.match(LESS) {
+		p.consume(IDENTIFIER, "Expect superclass name.")
+		superclass = NewVariable(p.previous())
+	}
+
+	p.consume(LEFT_BRACE, "Expect '{' before class body.")
+
+	methods := []*Function{}
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		methods = append(methods, p.function("method"))
+	}
+
+	p.consume(RIGHT_BRACE, "Expect '}' after class body.")
+	return NewClass(name, superclass, methods)
+}
+
+// function parses the name, parameters and body shared by every kind of
+// callable declaration
+func (p *Parser) function(kind string) *Function {
+	name := p.consume(IDENTIFIER, "Expect "+kind+" name.")
+
+	p.consume(LEFT_PAREN, "Expect '(' after "+kind+" name.")
+	params := []Token{}
+	if !p.check(RIGHT_PAREN) {
+		for {
+			if len(params) >= maxArguments {
+				p.report(CodeTooManyArguments, p.peek(), fmt.Sprintf("Can't have more than %d parameters.", maxArguments))
+			}
+			params = append(params, p.consume(IDENTIFIER, "Expect parameter name."))
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	}
+	p.consume(RIGHT_PAREN, "Expect ')' after parameters.")
+
+	p.consume(LEFT_BRACE, "Expect '{' before "+kind+" body.")
+	body := p.block()
+	return NewFunction(name, params, body)
+}
+
+func (p *Parser) varDeclaration() Stmt {
+	name := p.consume(IDENTIFIER, "Expect variable name.")
+
+	var initializer Expr
+	if p.match(EQUAL) {
+		initializer = p.expression()
+	}
+
+	p.consume(SEMICOLON, "Expect ';' after variable declaration.")
+	return NewVar(name, initializer)
+}
+
+func (p *Parser) statement() Stmt {
+	if p.match(FOR) {
+		return p.forStatement()
+	}
+	if p.match(IF) {
+		return p.ifStatement()
+	}
+	if p.match(PRINT) {
+		return p.printStatement()
+	}
+	if p.match(RETURN) {
+		return p.returnStatement()
+	}
+	if p.match(WHILE) {
+		return p.whileStatement()
+	}
+	if p.match(LEFT_BRACE) {
+		return NewBlock(p.block())
+	}
+	return p.expressionStatement()
+}
+
+func (p *Parser) block() []Stmt {
+	statements := []Stmt{}
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		if stmt := p.declaration(); stmt != nil {
+			statements = append(statements, stmt)
+		}
+	}
+
+	p.consume(RIGHT_BRACE, "Expect '}' after block.")
+	return statements
+}
+
+// forStatement desugars a for loop into a while loop wrapped in blocks
+func (p *Parser) forStatement() Stmt {
+	keyword := p.previous()
+	p.consume(LEFT_PAREN, "Expect '(' after 'for'.")
+
+	var initializer Stmt
+	if p.match(SEMICOLON) {
+		initializer = nil
+	} else if p.match(VAR) {
+		initializer = p.varDeclaration()
+	} else {
+		initializer = p.expressionStatement()
+	}
+
+	var condition Expr
+	if !p.check(SEMICOLON) {
+		condition = p.expression()
+	}
+	p.consume(SEMICOLON, "Expect ';' after loop condition.")
+
+	var increment Expr
+	if !p.check(RIGHT_PAREN) {
+		increment = p.expression()
+	}
+	p.consume(RIGHT_PAREN, "Expect ')' after for clauses.")
+
+	body := p.statement()
+
+	if increment != nil {
+		body = NewBlock([]Stmt{body, NewExpression(increment)})
+	}
+	if condition == nil {
+		// Located at the 'for' keyword, which stands in for the missing condition
+		token := NewToken(TRUE, keyword.Lexeme, nil, keyword.Line, keyword.Column, keyword.Offset)
+		token.Source = keyword.Source
+		condition = NewLiteral(true, *token, token.Span())
+	}
+	body = NewWhile(condition, body)
+	if initializer != nil {
+		body = NewBlock([]Stmt{initializer, body})
+	}
+	return body
+}
+
+func (p *Parser) ifStatement() Stmt {
+	p.consume(LEFT_PAREN, "Expect '(' after 'if'.")
+	condition := p.expression()
+	p.consume(RIGHT_PAREN, "Expect ')' after if condition.")
+
+	thenBranch := p.statement()
+	var elseBranch Stmt
+	if p.match(ELSE) {
+		elseBranch = p.statement()
 	}
-	return expr, nil
+	return NewIf(condition, thenBranch, elseBranch)
+}
+
+func (p *Parser) printStatement() Stmt {
+	value := p.expression()
+	p.consume(SEMICOLON, "Expect ';' after value.")
+	return NewPrint(value)
+}
+
+func (p *Parser) returnStatement() Stmt {
+	keyword := p.previous()
+
+	var value Expr
+	if !p.check(SEMICOLON) {
+		value = p.expression()
+	}
+
+	p.consume(SEMICOLON, "Expect ';' after return value.")
+	return NewReturn(keyword, value)
+}
+
+func (p *Parser) whileStatement() Stmt {
+	p.consume(LEFT_PAREN, "Expect '(' after 'while'.")
+	condition := p.expression()
+	p.consume(RIGHT_PAREN, "Expect ')' after condition.")
+	body := p.statement()
+	return NewWhile(condition, body)
+}
+
+func (p *Parser) expressionStatement() Stmt {
+	expr := p.expression()
+	p.consume(SEMICOLON, "Expect ';' after expression.")
+	return NewExpression(expr)
 }
 
 // Expression parsing methods
 func (p *Parser) expression() Expr {
-	return p.equality()
+	return p.assignment()
+}
+
+func (p *Parser) assignment() Expr {
+	expr := p.or()
+
+	if p.match(EQUAL) {
+		equals := p.previous()
+		value := p.assignment()
+
+		switch target := expr.(type) {
+		case *Variable:
+			return NewAssign(target.Name, value)
+		case *Get:
+			return NewSet(target.Object, target.Name, value)
+		}
+		// Report but don't unwind, the parser isn't confused here
+		p.report(
+			CodeInvalidAssignment,
+			equals,
+			"Invalid assignment target.",
+			"only variables and properties can be assigned to",
+		)
+	}
+	return expr
+}
+
+func (p *Parser) or() Expr {
+	expr := p.and()
+	for p.match(OR) {
+		operator := p.previous()
+		right := p.and()
+		expr = NewLogical(expr, operator, right)
+	}
+	return expr
+}
+
+func (p *Parser) and() Expr {
+	expr := p.equality()
+	for p.match(AND) {
+		operator := p.previous()
+		right := p.equality()
+		expr = NewLogical(expr, operator, right)
+	}
+	return expr
 }
 
 func (p *Parser) equality() Expr {
@@ -79,7 +360,7 @@ func (p *Parser) term() Expr {
 
 func (p *Parser) factor() Expr {
 	expr := p.unary()
-	for p.match(SLASH, STAR) {
+	for p.match(SLASH, STAR, PERCENT) {
 		operator := p.previous()
 		right := p.unary()
 		expr = NewBinary(expr, operator, right)
@@ -93,26 +374,78 @@ func (p *Parser) unary() Expr {
 		right := p.unary()
 		return NewUnary(operator, right)
 	}
-	return p.primary()
+	return p.call()
+}
+
+func (p *Parser) call() Expr {
+	expr := p.primary()
+	for {
+		if p.match(LEFT_PAREN) {
+			expr = p.finishCall(expr)
+		} else if p.match(DOT) {
+			name := p.consume(IDENTIFIER, "Expect property name after '.'.")
+			expr = NewGet(expr, name)
+		} else {
+			break
+		}
+	}
+	return expr
+}
+
+func (p *Parser) finishCall(callee Expr) Expr {
+	arguments := []Expr{}
+	if !p.check(RIGHT_PAREN) {
+		for {
+			if len(arguments) >= maxArguments {
+				p.report(CodeTooManyArguments, p.peek(), fmt.Sprintf("Can't have more than %d arguments.", maxArguments))
+			}
+			arguments = append(arguments, p.expression())
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	}
+
+	paren := p.consume(RIGHT_PAREN, "Expect ')' after arguments.")
+	return NewCall(callee, paren, arguments)
+}
+
+// literal makes a literal of value from the token just matched.
+func (p *Parser) literal(value any) *Literal {
+	token := p.previous()
+	return NewLiteral(value, token, token.Span())
 }
 
 func (p *Parser) primary() Expr {
 	if p.match(FALSE) {
-		return NewLiteral(false)
+		return p.literal(false)
 	}
 	if p.match(TRUE) {
-		return NewLiteral(true)
+		return p.literal(true)
 	}
 	if p.match(NIL) {
-		return NewLiteral(nil)
+		return p.literal(nil)
 	}
 	if p.match(NUMBER, STRING) {
-		return NewLiteral(p.previous().Literal)
+		return p.literal(p.previous().Literal)
+	}
+	if p.match(SUPER) {
+		keyword := p.previous()
+		p.consume(DOT, "Expect '.' after 'super'.")
+		method := p.consume(IDENTIFIER, "Expect superclass method name.")
+		return NewSuper(keyword, method)
+	}
+	if p.match(THIS) {
+		return NewThis(p.previous())
+	}
+	if p.match(IDENTIFIER) {
+		return NewVariable(p.previous())
 	}
 	if p.match(LEFT_PAREN) {
+		leftParen := p.previous()
 		expr := p.expression()
-		p.consume(RIGHT_PAREN, "Expect ')' after expression")
-		return NewGrouping(expr)
+		rightParen := p.consume(RIGHT_PAREN, "Expect ')' after expression")
+		return NewGrouping(leftParen, expr, rightParen)
 	}
 	panic(p.error(p.peek(), "Expect expression."))
 }
@@ -125,11 +458,17 @@ func (p *Parser) consume(tokenType TokenType, message string) Token {
 	panic(p.error(p.peek(), message))
 }
 
-func (p *Parser) error(token Token, message string) error {
-	if token.Type == EOF {
-		return p.lox.report(token.Line, "at end", message)
-	}
-	return p.lox.report(token.Line, "at '"+token.Lexeme+"'", message)
+func (p *Parser) error(token Token, message string) *ParseError {
+	return p.report(CodeSyntax, token, message)
+}
+
+// report records a syntax error without unwinding, for mistakes the parser
+// can step over. Callers that can't continue panic with the result.
+func (p *Parser) report(code string, token Token, message string, notes ...string) *ParseError {
+	err := NewParseError(token, tokenDiagnostic(code, token, message, notes...))
+	p.errors = append(p.errors, err)
+	p.reporter.report(err.Diagnostic)
+	return err
 }
 
 func (p *Parser) synchronize() {
@@ -166,19 +505,34 @@ func (p *Parser) check(tokenType TokenType) bool {
 
 func (p *Parser) advance() Token {
 	if !p.isAtEnd() {
-		p.current++
+		p.previousToken = p.currentToken
+		p.currentToken = p.read()
 	}
 	return p.previous()
 }
 
+// read pulls the next token from the source.
+func (p *Parser) read() Token {
+	token, err := p.tokens.Next()
+	if err != nil {
+		if p.err == nil {
+			p.err = err
+		}
+		eof := NewToken(EOF, "", nil, token.Line, token.Column, token.Offset)
+		eof.Source = token.Source
+		return *eof
+	}
+	return token
+}
+
 func (p *Parser) isAtEnd() bool {
 	return p.peek().Type == EOF
 }
 
 func (p *Parser) peek() Token {
-	return p.tokens[p.current]
+	return p.currentToken
 }
 
 func (p *Parser) previous() Token {
-	return p.tokens[p.current-1]
+	return p.previousToken
 }
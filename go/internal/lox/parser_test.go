@@ -0,0 +1,54 @@
+package lox
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParserRecoversFromEachError(t *testing.T) {
+	source := `var = 1;
+print "fine";
+print 1 +;
+1 = 2;
+fun f( { }
+if (true) print "ok"
+class A { m() {} }
+print "last";
+`
+	want := []struct {
+		code    string
+		message string
+		line    int
+		column  int
+	}{
+		{CodeSyntax, "Expect variable name.", 1, 5},
+		{CodeSyntax, "Expect expression.", 3, 10},
+		{CodeInvalidAssignment, "Invalid assignment target.", 4, 3},
+		{CodeSyntax, "Expect parameter name.", 5, 8},
+		{CodeSyntax, "Expect ';' after value.", 7, 1},
+	}
+
+	reporter := NewReporter(io.Discard, "<test>", source)
+	statements, errs := NewParser(NewScanner(strings.NewReader(source), reporter), reporter).Parse()
+
+	diagnostics := reporter.Diagnostics()
+	if len(diagnostics) != len(want) || len(errs) != len(want) {
+		t.Fatalf("got %d diagnostics and %d errors, want %d: %v", len(diagnostics), len(errs), len(want), diagnostics)
+	}
+	for idx, diagnostic := range diagnostics {
+		w := want[idx]
+		if diagnostic.Code != w.code || diagnostic.Message != w.message ||
+			diagnostic.Span.Line != w.line || diagnostic.Span.Column != w.column {
+			t.Errorf("diagnostic %d is %s[%s] at %d:%d, want %s[%s] at %d:%d", idx,
+				diagnostic.Message, diagnostic.Code, diagnostic.Span.Line, diagnostic.Span.Column,
+				w.message, w.code, w.line, w.column)
+		}
+	}
+
+	// The prints either side of the errors, and the bad assignment, which
+	// is reported without discarding anything
+	if len(statements) != 3 {
+		t.Errorf("got %d statements, want 3", len(statements))
+	}
+}
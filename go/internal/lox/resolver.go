@@ -0,0 +1,308 @@
+package lox
+
+type FunctionType int
+
+const (
+	FUNCTION_NONE FunctionType = iota
+	FUNCTION_FUNCTION
+	FUNCTION_INITIALIZER
+	FUNCTION_METHOD
+)
+
+type ClassType int
+
+const (
+	CLASS_NONE ClassType = iota
+	CLASS_CLASS
+	CLASS_SUBCLASS
+)
+
+// Resolver walks the AST once before execution and records on each
+// variable use how many scopes separate it from its declaration, or -1 for
+// a global. The Compiler resolves variables itself and only needs the
+// static errors.
+type Resolver struct {
+	scopes          []map[string]bool
+	currentFunction FunctionType
+	currentClass    ClassType
+	reporter        *Reporter
+}
+
+func NewResolver(reporter *Reporter) *Resolver {
+	return &Resolver{
+		scopes:          []map[string]bool{},
+		currentFunction: FUNCTION_NONE,
+		currentClass:    CLASS_NONE,
+		reporter:        reporter,
+	}
+}
+
+func (r *Resolver) Resolve(statements []Stmt) {
+	for _, statement := range statements {
+		r.resolveStmt(statement)
+	}
+}
+
+// Statements
+func (r *Resolver) VisitBlockStmt(stmt *Block) interface{} {
+	r.beginScope()
+	r.Resolve(stmt.Statements)
+	r.endScope()
+	return nil
+}
+
+func (r *Resolver) VisitClassStmt(stmt *Class) interface{} {
+	enclosingClass := r.currentClass
+	r.currentClass = CLASS_CLASS
+
+	r.declare(stmt.Name)
+	r.define(stmt.Name)
+
+	if stmt.Superclass != nil {
+		if stmt.Name.Lexeme == stmt.Superclass.Name.Lexeme {
+			r.error(CodeSelfInheritance, stmt.Superclass.Name, "A class can't inherit from itself.")
+		}
+
+		r.currentClass = CLASS_SUBCLASS
+		r.resolveExpr(stmt.Superclass)
+
+		r.beginScope()
+		r.peekScope()["super"] = true
+	}
+
+	r.beginScope()
+	r.peekScope()["this"] = true
+
+	for _, method := range stmt.Methods {
+		declaration := FUNCTION_METHOD
+		if method.Name.Lexeme == "init" {
+			declaration = FUNCTION_INITIALIZER
+		}
+		r.resolveFunction(method, declaration)
+	}
+
+	r.endScope()
+
+	if stmt.Superclass != nil {
+		r.endScope()
+	}
+
+	r.currentClass = enclosingClass
+	return nil
+}
+
+func (r *Resolver) VisitExpressionStmt(stmt *Expression) interface{} {
+	r.resolveExpr(stmt.Expression)
+	return nil
+}
+
+func (r *Resolver) VisitFunctionStmt(stmt *Function) interface{} {
+	// Define eagerly so the function can refer to itself recursively
+	r.declare(stmt.Name)
+	r.define(stmt.Name)
+
+	r.resolveFunction(stmt, FUNCTION_FUNCTION)
+	return nil
+}
+
+func (r *Resolver) VisitIfStmt(stmt *If) interface{} {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.ThenBranch)
+	if stmt.ElseBranch != nil {
+		r.resolveStmt(stmt.ElseBranch)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitPrintStmt(stmt *Print) interface{} {
+	r.resolveExpr(stmt.Expression)
+	return nil
+}
+
+func (r *Resolver) VisitReturnStmt(stmt *Return) interface{} {
+	if r.currentFunction == FUNCTION_NONE {
+		r.error(CodeTopLevelReturn, stmt.Keyword, "Can't return from top-level code.")
+	}
+
+	if stmt.Value != nil {
+		if r.currentFunction == FUNCTION_INITIALIZER {
+			r.error(CodeInitializerReturn, stmt.Keyword, "Can't return a value from an initializer.")
+		}
+		r.resolveExpr(stmt.Value)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitVarStmt(stmt *Var) interface{} {
+	r.declare(stmt.Name)
+	if stmt.Initializer != nil {
+		r.resolveExpr(stmt.Initializer)
+	}
+	r.define(stmt.Name)
+	return nil
+}
+
+func (r *Resolver) VisitWhileStmt(stmt *While) interface{} {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.Body)
+	return nil
+}
+
+// Expressions
+func (r *Resolver) VisitAssignExpr(expr *Assign) interface{} {
+	r.resolveExpr(expr.Value)
+	r.resolveLocal(&expr.Depth, expr.Name)
+	return nil
+}
+
+func (r *Resolver) VisitBinaryExpr(expr *Binary) interface{} {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+	return nil
+}
+
+func (r *Resolver) VisitCallExpr(expr *Call) interface{} {
+	r.resolveExpr(expr.Callee)
+	for _, argument := range expr.Arguments {
+		r.resolveExpr(argument)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitGetExpr(expr *Get) interface{} {
+	r.resolveExpr(expr.Object)
+	return nil
+}
+
+func (r *Resolver) VisitGroupingExpr(expr *Grouping) interface{} {
+	r.resolveExpr(expr.Expression)
+	return nil
+}
+
+func (r *Resolver) VisitLiteralExpr(expr *Literal) interface{} {
+	return nil
+}
+
+func (r *Resolver) VisitLogicalExpr(expr *Logical) interface{} {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+	return nil
+}
+
+func (r *Resolver) VisitSetExpr(expr *Set) interface{} {
+	r.resolveExpr(expr.Value)
+	r.resolveExpr(expr.Object)
+	return nil
+}
+
+func (r *Resolver) VisitSuperExpr(expr *Super) interface{} {
+	if r.currentClass == CLASS_NONE {
+		r.error(CodeSuperOutsideClass, expr.Keyword, "Can't use 'super' outside of a class.")
+		return nil
+	} else if r.currentClass != CLASS_SUBCLASS {
+		r.error(CodeSuperWithoutSuperclass, expr.Keyword, "Can't use 'super' in a class with no superclass.")
+		return nil
+	}
+
+	r.resolveLocal(&expr.Depth, expr.Keyword)
+	return nil
+}
+
+func (r *Resolver) VisitThisExpr(expr *This) interface{} {
+	if r.currentClass == CLASS_NONE {
+		r.error(CodeThisOutsideClass, expr.Keyword, "Can't use 'this' outside of a class.")
+		return nil
+	}
+
+	r.resolveLocal(&expr.Depth, expr.Keyword)
+	return nil
+}
+
+func (r *Resolver) VisitUnaryExpr(expr *Unary) interface{} {
+	r.resolveExpr(expr.Right)
+	return nil
+}
+
+func (r *Resolver) VisitVariableExpr(expr *Variable) interface{} {
+	if len(r.scopes) > 0 {
+		if defined, ok := r.peekScope()[expr.Name.Lexeme]; ok && !defined {
+			r.error(CodeSelfInitializer, expr.Name, "Can't read local variable in its own initializer.")
+		}
+	}
+
+	r.resolveLocal(&expr.Depth, expr.Name)
+	return nil
+}
+
+// Helpers
+func (r *Resolver) resolveStmt(stmt Stmt) {
+	stmt.Accept(r)
+}
+
+func (r *Resolver) resolveExpr(expr Expr) {
+	expr.Accept(r)
+}
+
+func (r *Resolver) resolveFunction(function *Function, functionType FunctionType) {
+	enclosingFunction := r.currentFunction
+	r.currentFunction = functionType
+
+	r.beginScope()
+	for _, param := range function.Params {
+		r.declare(param)
+		r.define(param)
+	}
+	r.Resolve(function.Body)
+	r.endScope()
+
+	r.currentFunction = enclosingFunction
+}
+
+// resolveLocal records the depth of the innermost scope declaring name.
+// Names not found in any scope are left unresolved and treated as globals.
+// resolveLocal sets depth to how many scopes out name is declared, -1 when
+// it isn't in any and so must be global.
+func (r *Resolver) resolveLocal(depth *int, name Token) {
+	for idx := len(r.scopes) - 1; idx >= 0; idx-- {
+		if _, ok := r.scopes[idx][name.Lexeme]; ok {
+			*depth = len(r.scopes) - 1 - idx
+			return
+		}
+	}
+	*depth = -1
+}
+
+func (r *Resolver) beginScope() {
+	r.scopes = append(r.scopes, map[string]bool{})
+}
+
+func (r *Resolver) endScope() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *Resolver) peekScope() map[string]bool {
+	return r.scopes[len(r.scopes)-1]
+}
+
+func (r *Resolver) declare(name Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+
+	scope := r.peekScope()
+	if _, ok := scope[name.Lexeme]; ok {
+		r.error(CodeDuplicateDeclaration, name, "Already a variable with this name in this scope.")
+	}
+	scope[name.Lexeme] = false
+}
+
+func (r *Resolver) define(name Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+	r.peekScope()[name.Lexeme] = true
+}
+
+func (r *Resolver) error(code string, token Token, message string, notes ...string) {
+	r.reporter.report(tokenDiagnostic(code, token, message, notes...))
+}
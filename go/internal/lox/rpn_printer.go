@@ -0,0 +1,86 @@
+package lox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RpnPrinter prints expressions in reverse Polish notation, operands
+// before their operator, so (1 + 2) * (4 - 3) is 1 2 + 4 3 - *. Groupings
+// leave no trace, the order alone shows how the parser grouped things.
+type RpnPrinter struct{}
+
+func NewRpnPrinter() *RpnPrinter {
+	return &RpnPrinter{}
+}
+
+func (rp *RpnPrinter) Print(expr Expr) string {
+	return expr.Accept(rp).(string)
+}
+
+func (rp *RpnPrinter) VisitAssignExpr(expr *Assign) interface{} {
+	return rp.postfix("=", NewVariable(expr.Name), expr.Value)
+}
+
+func (rp *RpnPrinter) VisitBinaryExpr(expr *Binary) interface{} {
+	return rp.postfix(expr.Operator.Lexeme, expr.Left, expr.Right)
+}
+
+// VisitCallExpr writes the argument count with the call, since it can't be
+// told from the operands.
+func (rp *RpnPrinter) VisitCallExpr(expr *Call) interface{} {
+	operator := fmt.Sprintf("call/%d", len(expr.Arguments))
+	return rp.postfix(operator, append([]Expr{expr.Callee}, expr.Arguments...)...)
+}
+
+func (rp *RpnPrinter) VisitGetExpr(expr *Get) interface{} {
+	return rp.postfix("."+expr.Name.Lexeme, expr.Object)
+}
+
+func (rp *RpnPrinter) VisitGroupingExpr(expr *Grouping) interface{} {
+	return rp.Print(expr.Expression)
+}
+
+func (rp *RpnPrinter) VisitLiteralExpr(expr *Literal) interface{} {
+	return literalSource(expr.Value)
+}
+
+func (rp *RpnPrinter) VisitLogicalExpr(expr *Logical) interface{} {
+	return rp.postfix(expr.Operator.Lexeme, expr.Left, expr.Right)
+}
+
+func (rp *RpnPrinter) VisitSetExpr(expr *Set) interface{} {
+	return rp.postfix("."+expr.Name.Lexeme+"=", expr.Object, expr.Value)
+}
+
+func (rp *RpnPrinter) VisitSuperExpr(expr *Super) interface{} {
+	return "super." + expr.Method.Lexeme
+}
+
+func (rp *RpnPrinter) VisitThisExpr(expr *This) interface{} {
+	return "this"
+}
+
+// VisitUnaryExpr writes negation as ~ so it reads differently from
+// subtraction.
+func (rp *RpnPrinter) VisitUnaryExpr(expr *Unary) interface{} {
+	operator := expr.Operator.Lexeme
+	if expr.Operator.Type == MINUS {
+		operator = "~"
+	}
+	return rp.postfix(operator, expr.Right)
+}
+
+func (rp *RpnPrinter) VisitVariableExpr(expr *Variable) interface{} {
+	return expr.Name.Lexeme
+}
+
+func (rp *RpnPrinter) postfix(operator string, operands ...Expr) string {
+	var builder strings.Builder
+	for _, operand := range operands {
+		builder.WriteString(rp.Print(operand))
+		builder.WriteString(" ")
+	}
+	builder.WriteString(operator)
+	return builder.String()
+}
@@ -2,40 +2,81 @@ package lox
 
 import (
 	"fmt"
+	"io"
+	"slices"
 	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// scanChunkSize is how many bytes the Scanner asks its reader for at once.
+const scanChunkSize = 4096
+
+// Scanner turns source read from an io.Reader into tokens on demand. It
+// only buffers the input of the token being scanned, so Span offsets count
+// from the start of the input. The Scanner doesn't keep the rest of it,
+// though a Reporter reading the input through Source does.
 type Scanner struct {
-	source string
-	tokens []Token
+	reader io.Reader
+	// buffer holds the input from offset base on, err is the first read
+	// error and eof is set once the reader is drained.
+	buffer []byte
+	base   int
+	eof    bool
+	err    error
+	// token is set by scanToken when it finds a token
+	token *Token
 
 	start   int
 	current int
 	line    int
 
-	lox *Lox
+	// lineStart is the offset where the current line begins and
+	// currentColumn the column of current, counted in runes. startLine and
+	// startColumn locate the token being scanned.
+	lineStart     int
+	currentColumn int
+	startLine     int
+	startColumn   int
+
+	reporter *Reporter
 }
 
-func NewScanner(source string, lox *Lox) *Scanner {
+func NewScanner(reader io.Reader, reporter *Reporter) *Scanner {
 	return &Scanner{
-		source:  source,
-		tokens:  []Token{},
-		start:   0,
-		current: 0,
-		line:    1,
-		lox:     lox,
+		reader:        reader,
+		start:         0,
+		current:       0,
+		line:          1,
+		lineStart:     0,
+		currentColumn: 1,
+		reporter:      reporter,
 	}
 }
 
-func (s *Scanner) scanTokens() []Token {
-	for !s.isAtEnd() {
+// Next scans and returns the next token. At the end of the input it
+// returns EOF, and keeps doing so. Mistakes in the source are reported and
+// skipped, the error comes with EOF when reading the input failed.
+func (s *Scanner) Next() (Token, error) {
+	for s.token == nil {
+		if s.isAtEnd() {
+			s.token = NewToken(EOF, "", nil, s.line, s.column(), s.current)
+			s.token.Source = s.reporter.origin
+			break
+		}
 		s.start = s.current
+		s.startLine = s.line
+		s.startColumn = s.column()
 		s.scanToken()
 	}
 
-	token := NewToken(EOF, "", nil, s.line)
-	s.tokens = append(s.tokens, *token)
-	return s.tokens
+	token := *s.token
+	if token.Type == EOF {
+		return token, s.err
+	}
+	s.token = nil
+	return token, nil
 }
 
 func (s *Scanner) scanToken() {
@@ -61,6 +102,8 @@ func (s *Scanner) scanToken() {
 		s.addToken(SEMICOLON)
 	case '*':
 		s.addToken(STAR)
+	case '%':
+		s.addToken(PERCENT)
 
 	case '!':
 		s.addMatchToken('=', BANG_EQUAL, BANG)
@@ -76,69 +119,284 @@ func (s *Scanner) scanToken() {
 
 	case '"':
 		s.captureString()
+	case '`':
+		s.captureRawString()
 
 	case ' ', '\r', '\t':
 		// Ignore whitespace
 	case '\n':
-		s.line++
+		s.newline()
 
 	default:
 		if s.isDigit(c) {
 			s.captureNumber()
 		} else if s.isAlpha(c) {
 			s.captureIdentifier()
+		} else if c == utf8.RuneError {
+			// advance reported the invalid UTF-8 already
 		} else {
-			s.lox.error(s.line, fmt.Sprintf("Unexpected character: %q", c))
+			s.error(CodeUnexpectedCharacter, fmt.Sprintf("Unexpected character: %q", c))
 		}
 	}
 }
 
+// captureString scans a double quoted string, decoding its escape
+// sequences. Bad escapes are reported and the rest of the string is still
+// scanned.
 func (s *Scanner) captureString() {
+	var value strings.Builder
 	for s.peek() != '"' && !s.isAtEnd() {
-		if s.peek() == '\n' {
-			s.line++
+		c := s.advance()
+		switch c {
+		case '\n':
+			s.newline()
+		case '\\':
+			s.escape(&value)
+			continue
 		}
-		s.advance()
+		value.WriteRune(c)
 	}
 
 	if s.isAtEnd() {
-		s.lox.error(s.line, "Unterminated string")
+		s.error(CodeUnterminatedString, "Unterminated string", "the string starts here and runs to the end of the file")
 		return
 	}
 	s.advance()
 
-	value := s.source[s.start+1 : s.current-1]
-	s.addTokenWithLiteral(STRING, value)
+	s.addTokenWithLiteral(STRING, value.String())
 }
 
-func (s *Scanner) captureNumber() {
-	for s.isDigit(s.peek()) {
+// captureRawString scans a backtick delimited string, which keeps newlines
+// and backslashes as written.
+func (s *Scanner) captureRawString() {
+	for s.peek() != '`' && !s.isAtEnd() {
+		if s.advance() == '\n' {
+			s.newline()
+		}
+	}
+
+	if s.isAtEnd() {
+		s.error(CodeUnterminatedString, "Unterminated raw string", "the string starts here and runs to the end of the file")
+		return
+	}
+	s.advance()
+
+	s.addTokenWithLiteral(STRING, s.text(s.start+1, s.current-1))
+}
+
+// escape decodes the escape sequence after a backslash into value.
+func (s *Scanner) escape(value *strings.Builder) {
+	start := s.current - 1
+	if s.isAtEnd() {
+		return
+	}
+
+	switch c := s.advance(); c {
+	case 'n':
+		value.WriteByte('\n')
+	case 't':
+		value.WriteByte('\t')
+	case 'r':
+		value.WriteByte('\r')
+	case '0':
+		value.WriteByte(0)
+	case '\\', '"':
+		value.WriteRune(c)
+	case 'u':
+		s.unicodeEscape(start, value)
+	default:
+		s.errorAt(start, s.current, CodeInvalidEscape, fmt.Sprintf("Unknown escape sequence '\\%c'", c),
+			`valid escapes are \n \t \r \0 \\ \" and \u{...}`,
+			"use a `raw string` to keep backslashes as written")
+		if c == '\n' {
+			s.newline()
+		}
+	}
+}
+
+// unicodeEscape decodes the {XXXX} part of a \u{XXXX} escape starting at
+// start.
+func (s *Scanner) unicodeEscape(start int, value *strings.Builder) {
+	if !s.match('{') {
+		s.errorAt(start, s.current, CodeInvalidEscape, "Expect '{' after '\\u'", "write code points like \\u{1F600}")
+		return
+	}
+
+	digitsStart := s.current
+	for digitValue(s.peek()) < 16 {
 		s.advance()
 	}
+	digits := s.text(digitsStart, s.current)
+	if !s.match('}') {
+		s.errorAt(start, s.current, CodeInvalidEscape, "Expect '}' after unicode escape digits")
+		return
+	}
+
+	if len(digits) == 0 || len(digits) > 6 {
+		s.errorAt(start, s.current, CodeInvalidEscape, "Unicode escape must have 1 to 6 hex digits")
+		return
+	}
+	codePoint, _ := strconv.ParseUint(digits, 16, 32)
+	if !utf8.ValidRune(rune(codePoint)) {
+		s.errorAt(start, s.current, CodeInvalidEscape, fmt.Sprintf("Invalid unicode code point U+%s", strings.ToUpper(digits)))
+		return
+	}
+	value.WriteRune(rune(codePoint))
+}
+
+// captureNumber scans decimal literals like 1_000, 1.5 and 2.5e-3 as well as
+// 0x, 0o and 0b prefixed integers. A malformed literal is reported and
+// still becomes a token so the parser doesn't report it again.
+func (s *Scanner) captureNumber() {
+	if s.text(s.start, s.start+1) == "0" {
+		switch s.peek() {
+		case 'x', 'X':
+			s.captureRadixNumber(16, "hexadecimal")
+			return
+		case 'o', 'O':
+			s.captureRadixNumber(8, "octal")
+			return
+		case 'b', 'B':
+			s.captureRadixNumber(2, "binary")
+			return
+		}
+	}
+
+	valid := s.digits(s.start, 10, "decimal")
+	isFloat := false
 
-	if s.peek() == '.' && s.isDigit(s.peekNext()) {
+	if s.peek() == '.' {
+		if !s.isDigit(s.peekNext()) && s.peekNext() != '_' {
+			s.advance()
+			s.errorAt(s.current-1, s.current, CodeInvalidNumber, "Expect digits after '.' in number",
+				"write "+s.text(s.start, s.current)+"0 for a float")
+			s.addTokenWithLiteral(NUMBER, 0.0)
+			return
+		}
 		s.advance()
+		isFloat = true
+		valid = s.digits(s.current, 10, "decimal") && valid
+	}
 
-		for s.isDigit(s.peek()) {
+	if s.peek() == 'e' || s.peek() == 'E' {
+		s.advance()
+		isFloat = true
+		if s.peek() == '+' || s.peek() == '-' {
 			s.advance()
 		}
+		if !s.isDigit(s.peek()) {
+			s.errorAt(s.start, s.current, CodeInvalidNumber, "Expect digits in exponent")
+			valid = false
+		} else {
+			valid = s.digits(s.current, 10, "decimal") && valid
+		}
+	}
+
+	if !valid {
+		s.addTokenWithLiteral(NUMBER, 0.0)
+		return
+	}
+
+	// Numbers without a decimal point or exponent are integers. One that's
+	// too large is still scanned as a float so the parser doesn't trip over it.
+	text := strings.ReplaceAll(s.text(s.start, s.current), "_", "")
+	if !isFloat {
+		value, err := strconv.ParseInt(text, 10, 64)
+		if err == nil {
+			s.addTokenWithLiteral(NUMBER, value)
+			return
+		}
+		s.error(CodeInvalidNumber, "Integer literal is too large", "integers must fit in 64 bits, write it with a decimal point for a float")
 	}
 
-	text := s.source[s.start:s.current]
 	value, err := strconv.ParseFloat(text, 64)
 	if err != nil {
-		s.lox.error(s.line, "Invalid number format")
+		// The syntax was checked above, so it's out of range
+		s.error(CodeInvalidNumber, "Float literal is too large", "floats must fit in 64 bits")
+		value = 0
+	}
+	s.addTokenWithLiteral(NUMBER, value)
+}
+
+// captureRadixNumber scans an integer after its 0x, 0o or 0b prefix.
+func (s *Scanner) captureRadixNumber(base int, name string) {
+	s.advance()
+	prefix := s.text(s.start, s.current)
+
+	digitsStart := s.current
+	for s.isAlphaNumeric(s.peek()) {
+		s.advance()
+	}
+	if s.current == digitsStart {
+		s.error(CodeInvalidNumber, fmt.Sprintf("Expect digits after '%s'", prefix))
+		s.addTokenWithLiteral(NUMBER, int64(0))
+		return
+	}
+	if !s.digits(digitsStart, base, name) {
+		s.addTokenWithLiteral(NUMBER, int64(0))
+		return
+	}
+
+	text := strings.ReplaceAll(s.text(digitsStart, s.current), "_", "")
+	value, err := strconv.ParseInt(text, base, 64)
+	if err != nil {
+		s.error(CodeInvalidNumber, "Integer literal is too large", "integers must fit in 64 bits")
+		s.addTokenWithLiteral(NUMBER, int64(0))
 		return
 	}
 	s.addTokenWithLiteral(NUMBER, value)
 }
 
+// digits consumes the decimal digits and separators following start, then
+// checks source[start:s.current] only holds digits of base with each '_'
+// between two of them. It reports the first problem and whether there was
+// none.
+func (s *Scanner) digits(start, base int, name string) bool {
+	for s.isDigit(s.peek()) || s.peek() == '_' {
+		s.advance()
+	}
+
+	text := s.text(start, s.current)
+	for idx, c := range text {
+		if c == '_' {
+			if idx == 0 || idx == len(text)-1 || text[idx+1] == '_' {
+				end := idx + 1
+				for end < len(text) && text[end] == '_' {
+					end++
+				}
+				s.errorAt(start+idx, start+end, CodeInvalidNumber, "Digit separator '_' must be between two digits")
+				return false
+			}
+			continue
+		}
+		if digitValue(c) >= base {
+			s.errorAt(start+idx, start+idx+utf8.RuneLen(c), CodeInvalidNumber, fmt.Sprintf("Invalid digit '%c' in %s literal", c, name))
+			return false
+		}
+	}
+	return true
+}
+
+// digitValue returns the value of c as a digit up to base 36, or 36 when c
+// isn't one.
+func digitValue(c rune) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return 36
+}
+
 func (s *Scanner) captureIdentifier() {
 	for s.isAlphaNumeric(s.peek()) {
 		s.advance()
 	}
 
-	text := s.source[s.start:s.current]
+	text := s.text(s.start, s.current)
 	tokenType, ok := keywords[text]
 	if !ok {
 		tokenType = IDENTIFIER
@@ -159,17 +417,19 @@ func (s *Scanner) captureComment() {
 				return
 			}
 			if s.peek() == '\n' {
-				s.line++
+				s.advance()
+				s.newline()
+				continue
 			}
 			s.advance()
 		}
-		s.lox.error(s.line, "Unterminated block comment")
+		s.error(CodeUnterminatedComment, "Unterminated block comment", "the comment starts here and runs to the end of the file")
 	} else {
 		s.addToken(SLASH)
 	}
 }
 
-func (s *Scanner) addMatchToken(expected byte, first, second TokenType) {
+func (s *Scanner) addMatchToken(expected rune, first, second TokenType) {
 	if s.match(expected) {
 		s.addToken(first)
 	} else {
@@ -182,54 +442,131 @@ func (s *Scanner) addToken(tokenType TokenType) {
 }
 
 func (s *Scanner) addTokenWithLiteral(tokenType TokenType, literal any) {
-	lexeme := s.source[s.start:s.current]
-	token := NewToken(tokenType, lexeme, literal, s.line)
-	s.tokens = append(s.tokens, *token)
+	lexeme := s.text(s.start, s.current)
+	s.token = NewToken(tokenType, lexeme, literal, s.startLine, s.startColumn, s.start)
+	s.token.Source = s.reporter.origin
 }
 
-func (s *Scanner) match(expected byte) bool {
-	if s.isAtEnd() {
-		return false
+// error reports message against the lexeme scanned so far.
+func (s *Scanner) error(code string, message string, notes ...string) {
+	s.errorAt(s.start, s.current, code, message, notes...)
+}
+
+// errorAt reports message against input[start:end], which must lie on
+// either the first or the current line of the lexeme being scanned.
+func (s *Scanner) errorAt(start, end int, code string, message string, notes ...string) {
+	line, column := s.startLine, s.startColumn+utf8.RuneCountInString(s.text(s.start, start))
+	if s.lineStart > s.start && start >= s.lineStart {
+		line, column = s.line, utf8.RuneCountInString(s.text(s.lineStart, start))+1
 	}
-	if s.source[s.current] != expected {
+
+	s.reporter.report(Diagnostic{
+		Code:    code,
+		Message: message,
+		Span: Span{
+			Start:  start,
+			End:    end,
+			Line:   line,
+			Column: column,
+			Source: s.reporter.origin,
+		},
+		Notes: notes,
+	})
+}
+
+// newline must be called after consuming each '\n'.
+func (s *Scanner) newline() {
+	s.line++
+	s.lineStart = s.current
+	s.currentColumn = 1
+}
+
+func (s *Scanner) column() int {
+	return s.currentColumn
+}
+
+func (s *Scanner) match(expected rune) bool {
+	if s.isAtEnd() || s.peek() != expected {
 		return false
 	}
-
-	s.current++
+	s.advance()
 	return true
 }
 
-func (s *Scanner) isDigit(c byte) bool {
+func (s *Scanner) isDigit(c rune) bool {
 	return c >= '0' && c <= '9'
 }
 
-func (s *Scanner) isAlpha(c byte) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+// isAlpha accepts any Unicode letter, so identifiers like café work.
+func (s *Scanner) isAlpha(c rune) bool {
+	return unicode.IsLetter(c) || c == '_'
 }
 
-func (s *Scanner) isAlphaNumeric(c byte) bool {
+func (s *Scanner) isAlphaNumeric(c rune) bool {
 	return s.isAlpha(c) || s.isDigit(c)
 }
 
-func (s *Scanner) peek() byte {
+func (s *Scanner) peek() rune {
 	if s.isAtEnd() {
 		return '\000'
 	}
-	return s.source[s.current]
+	r, _ := utf8.DecodeRune(s.buffer[s.current-s.base:])
+	return r
 }
 
-func (s *Scanner) peekNext() byte {
-	if s.current+1 >= len(s.source) {
+func (s *Scanner) peekNext() rune {
+	if s.isAtEnd() {
+		return '\000'
+	}
+	_, size := utf8.DecodeRune(s.buffer[s.current-s.base:])
+	s.fill(size + utf8.UTFMax)
+	if s.current+size >= s.base+len(s.buffer) {
 		return '\000'
 	}
-	return s.source[s.current+1]
+	r, _ := utf8.DecodeRune(s.buffer[s.current+size-s.base:])
+	return r
 }
 
 func (s *Scanner) isAtEnd() bool {
-	return s.current >= len(s.source)
+	s.fill(utf8.UTFMax)
+	return s.current >= s.base+len(s.buffer)
+}
+
+// advance consumes one rune. Invalid UTF-8 is reported and consumed a byte
+// at a time as utf8.RuneError.
+func (s *Scanner) advance() rune {
+	s.fill(utf8.UTFMax)
+	r, size := utf8.DecodeRune(s.buffer[s.current-s.base:])
+	if r == utf8.RuneError && size == 1 {
+		s.errorAt(s.current, s.current+1, CodeInvalidUTF8, fmt.Sprintf("Invalid UTF-8 byte 0x%02X", s.buffer[s.current-s.base]),
+			"Lox source must be UTF-8 encoded")
+	}
+	s.current += size
+	s.currentColumn++
+	return r
 }
 
-func (s *Scanner) advance() byte {
-	s.current++
-	return s.source[s.current-1]
+// text returns input[start:end], which must still be buffered.
+func (s *Scanner) text(start, end int) string {
+	return string(s.buffer[start-s.base : end-s.base])
+}
+
+// fill reads until n bytes past current are buffered or the input runs
+// out. Input before the current token is dropped to make room.
+func (s *Scanner) fill(n int) {
+	for !s.eof && s.current+n > s.base+len(s.buffer) {
+		if drop := s.start - s.base; drop > 0 {
+			s.buffer = s.buffer[:copy(s.buffer, s.buffer[drop:])]
+			s.base = s.start
+		}
+		s.buffer = slices.Grow(s.buffer, scanChunkSize)
+		read, err := s.reader.Read(s.buffer[len(s.buffer):cap(s.buffer)])
+		s.buffer = s.buffer[:len(s.buffer)+read]
+		if err != nil {
+			s.eof = true
+			if err != io.EOF {
+				s.err = err
+			}
+		}
+	}
 }
@@ -0,0 +1,240 @@
+package lox
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type scannedToken struct {
+	tokenType TokenType
+	lexeme    string
+	literal   any
+	line      int
+	column    int
+}
+
+type scannedDiagnostic struct {
+	code    string
+	message string
+	line    int
+	column  int
+}
+
+func TestScanner(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		tokens      []scannedToken
+		diagnostics []scannedDiagnostic
+	}{
+		{
+			name:   "radix integers",
+			source: "0xFF 0Xa_b 0o17 0b1010 0B1_1",
+			tokens: []scannedToken{
+				{NUMBER, "0xFF", int64(255), 1, 1},
+				{NUMBER, "0Xa_b", int64(171), 1, 6},
+				{NUMBER, "0o17", int64(15), 1, 12},
+				{NUMBER, "0b1010", int64(10), 1, 17},
+				{NUMBER, "0B1_1", int64(3), 1, 24},
+			},
+		},
+		{
+			name:   "digit separators and exponents",
+			source: "1_000 1_0.2_5 2.5e-3 1e1_0 1E+2",
+			tokens: []scannedToken{
+				{NUMBER, "1_000", int64(1000), 1, 1},
+				{NUMBER, "1_0.2_5", 10.25, 1, 7},
+				{NUMBER, "2.5e-3", 0.0025, 1, 15},
+				{NUMBER, "1e1_0", 1e10, 1, 22},
+				{NUMBER, "1E+2", 100.0, 1, 28},
+			},
+		},
+		{
+			name:   "misplaced separators",
+			source: "1__0 1_ 0x_1 1_.5",
+			tokens: []scannedToken{
+				{NUMBER, "1__0", 0.0, 1, 1},
+				{NUMBER, "1_", 0.0, 1, 6},
+				{NUMBER, "0x_1", int64(0), 1, 9},
+				{NUMBER, "1_.5", 0.0, 1, 14},
+			},
+			diagnostics: []scannedDiagnostic{
+				{CodeInvalidNumber, "Digit separator '_' must be between two digits", 1, 2},
+				{CodeInvalidNumber, "Digit separator '_' must be between two digits", 1, 7},
+				{CodeInvalidNumber, "Digit separator '_' must be between two digits", 1, 11},
+				{CodeInvalidNumber, "Digit separator '_' must be between two digits", 1, 15},
+			},
+		},
+		{
+			name:   "invalid digits",
+			source: "0b102 0o9 0xG 0x;",
+			tokens: []scannedToken{
+				{NUMBER, "0b102", int64(0), 1, 1},
+				{NUMBER, "0o9", int64(0), 1, 7},
+				{NUMBER, "0xG", int64(0), 1, 11},
+				{NUMBER, "0x", int64(0), 1, 15},
+				{SEMICOLON, ";", nil, 1, 17},
+			},
+			diagnostics: []scannedDiagnostic{
+				{CodeInvalidNumber, "Invalid digit '2' in binary literal", 1, 5},
+				{CodeInvalidNumber, "Invalid digit '9' in octal literal", 1, 9},
+				{CodeInvalidNumber, "Invalid digit 'G' in hexadecimal literal", 1, 13},
+				{CodeInvalidNumber, "Expect digits after '0x'", 1, 15},
+			},
+		},
+		{
+			name:   "missing fraction and exponent",
+			source: "1. 1e; 2",
+			tokens: []scannedToken{
+				{NUMBER, "1.", 0.0, 1, 1},
+				{NUMBER, "1e", 0.0, 1, 4},
+				{SEMICOLON, ";", nil, 1, 6},
+				{NUMBER, "2", int64(2), 1, 8},
+			},
+			diagnostics: []scannedDiagnostic{
+				{CodeInvalidNumber, "Expect digits after '.' in number", 1, 2},
+				{CodeInvalidNumber, "Expect digits in exponent", 1, 4},
+			},
+		},
+		{
+			name:   "out of range numbers",
+			source: "9223372036854775807 9223372036854775808 0x8000000000000000 1e400 1e308",
+			tokens: []scannedToken{
+				{NUMBER, "9223372036854775807", int64(9223372036854775807), 1, 1},
+				{NUMBER, "9223372036854775808", 9223372036854775808.0, 1, 21},
+				{NUMBER, "0x8000000000000000", int64(0), 1, 41},
+				{NUMBER, "1e400", 0.0, 1, 60},
+				{NUMBER, "1e308", 1e308, 1, 66},
+			},
+			diagnostics: []scannedDiagnostic{
+				{CodeInvalidNumber, "Integer literal is too large", 1, 21},
+				{CodeInvalidNumber, "Integer literal is too large", 1, 41},
+				{CodeInvalidNumber, "Float literal is too large", 1, 60},
+			},
+		},
+		{
+			name:   "escapes",
+			source: `"\n\t\r\0\\\"\u{41}\u{1F600}"`,
+			tokens: []scannedToken{
+				{STRING, `"\n\t\r\0\\\"\u{41}\u{1F600}"`, "\n\t\r\x00\\\"A😀", 1, 1},
+			},
+		},
+		{
+			name:   "bad escapes",
+			source: `"\q" "\u41" "\u{41" "\u{}" "\u{1234567}" "\u{D800}" "\u{110000}" "ok"`,
+			tokens: []scannedToken{
+				{STRING, `"\q"`, "", 1, 1},
+				{STRING, `"\u41"`, "41", 1, 6},
+				{STRING, `"\u{41"`, "", 1, 13},
+				{STRING, `"\u{}"`, "", 1, 21},
+				{STRING, `"\u{1234567}"`, "", 1, 28},
+				{STRING, `"\u{D800}"`, "", 1, 42},
+				{STRING, `"\u{110000}"`, "", 1, 53},
+				{STRING, `"ok"`, "ok", 1, 66},
+			},
+			diagnostics: []scannedDiagnostic{
+				{CodeInvalidEscape, `Unknown escape sequence '\q'`, 1, 2},
+				{CodeInvalidEscape, `Expect '{' after '\u'`, 1, 7},
+				{CodeInvalidEscape, "Expect '}' after unicode escape digits", 1, 14},
+				{CodeInvalidEscape, "Unicode escape must have 1 to 6 hex digits", 1, 22},
+				{CodeInvalidEscape, "Unicode escape must have 1 to 6 hex digits", 1, 29},
+				{CodeInvalidEscape, "Invalid unicode code point U+D800", 1, 43},
+				{CodeInvalidEscape, "Invalid unicode code point U+110000", 1, 54},
+			},
+		},
+		{
+			name:   "raw string",
+			source: "`a\nb\\n` x",
+			tokens: []scannedToken{
+				{STRING, "`a\nb\\n`", "a\nb\\n", 1, 1},
+				{IDENTIFIER, "x", nil, 2, 6},
+			},
+		},
+		{
+			name:   "unterminated raw string",
+			source: "`abc\nde",
+			diagnostics: []scannedDiagnostic{
+				{CodeUnterminatedString, "Unterminated raw string", 1, 1},
+			},
+		},
+		{
+			name:   "unterminated string",
+			source: "\"abc\nde",
+			diagnostics: []scannedDiagnostic{
+				{CodeUnterminatedString, "Unterminated string", 1, 1},
+			},
+		},
+		{
+			name:   "invalid UTF-8",
+			source: "a \xff b\n\"\xfe\" c",
+			tokens: []scannedToken{
+				{IDENTIFIER, "a", nil, 1, 1},
+				{IDENTIFIER, "b", nil, 1, 5},
+				{STRING, "\"\xfe\"", "�", 2, 1},
+				{IDENTIFIER, "c", nil, 2, 5},
+			},
+			diagnostics: []scannedDiagnostic{
+				{CodeInvalidUTF8, "Invalid UTF-8 byte 0xFF", 1, 3},
+				{CodeInvalidUTF8, "Invalid UTF-8 byte 0xFE", 2, 2},
+			},
+		},
+		{
+			name:   "multi-byte columns",
+			source: "\"héllo\" x\nπ 😀 y",
+			tokens: []scannedToken{
+				{STRING, "\"héllo\"", "héllo", 1, 1},
+				{IDENTIFIER, "x", nil, 1, 9},
+				{IDENTIFIER, "π", nil, 2, 1},
+				{IDENTIFIER, "y", nil, 2, 5},
+			},
+			diagnostics: []scannedDiagnostic{
+				{CodeUnexpectedCharacter, "Unexpected character: '😀'", 2, 3},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// A byte at a time, so no token or rune arrives in one read
+			reporter := NewReporter(io.Discard, "<test>", test.source)
+			scanner := NewScanner(iotest.OneByteReader(strings.NewReader(test.source)), reporter)
+
+			tokens := []scannedToken{}
+			for {
+				token, err := scanner.Next()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if token.Type == EOF {
+					break
+				}
+				tokens = append(tokens, scannedToken{token.Type, token.Lexeme, token.Literal, token.Line, token.Column})
+			}
+			if len(tokens) != len(test.tokens) {
+				t.Errorf("got tokens %#v, want %#v", tokens, test.tokens)
+			} else {
+				for idx, token := range tokens {
+					if token != test.tokens[idx] {
+						t.Errorf("token %d is %#v, want %#v", idx, token, test.tokens[idx])
+					}
+				}
+			}
+
+			diagnostics := []scannedDiagnostic{}
+			for _, diagnostic := range reporter.Diagnostics() {
+				diagnostics = append(diagnostics, scannedDiagnostic{diagnostic.Code, diagnostic.Message, diagnostic.Span.Line, diagnostic.Span.Column})
+			}
+			if len(diagnostics) != len(test.diagnostics) {
+				t.Errorf("got diagnostics %v, want %v", diagnostics, test.diagnostics)
+			} else {
+				for idx, diagnostic := range diagnostics {
+					if diagnostic != test.diagnostics[idx] {
+						t.Errorf("diagnostic %d is %v, want %v", idx, diagnostic, test.diagnostics[idx])
+					}
+				}
+			}
+		})
+	}
+}
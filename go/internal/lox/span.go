@@ -0,0 +1,102 @@
+package lox
+
+// Span locates a range of source text. Start and End are byte offsets with
+// End exclusive, Line and Column are 1-based and describe Start. The zero
+// Span means the position is unknown.
+type Span struct {
+	Start  int
+	End    int
+	Line   int
+	Column int
+	// Source is the text the span points into, nil when that isn't known.
+	Source *Source
+}
+
+// Source identifies one scanned text, such as a file or a REPL line.
+// Functions outlive the run that defined them, so a span is only quoted
+// against the text of the run whose Source it has.
+type Source struct {
+	Name string
+}
+
+func (s Span) IsKnown() bool {
+	return s.Line > 0
+}
+
+// Join returns the smallest span covering both s and other.
+func (s Span) Join(other Span) Span {
+	if !s.IsKnown() {
+		return other
+	}
+	if !other.IsKnown() {
+		return s
+	}
+
+	joined := s
+	if other.Start < joined.Start {
+		joined.Start, joined.Line, joined.Column = other.Start, other.Line, other.Column
+	}
+	if other.End > joined.End {
+		joined.End = other.End
+	}
+	return joined
+}
+
+// ExprSpan returns the source range covered by the whole expression.
+func ExprSpan(expr Expr) Span {
+	if expr == nil {
+		return Span{}
+	}
+	return expr.Accept(spanner{}).(Span)
+}
+
+// spanner joins the spans of the tokens at either edge of an expression.
+type spanner struct{}
+
+func (sp spanner) VisitAssignExpr(expr *Assign) interface{} {
+	return expr.Name.Span().Join(ExprSpan(expr.Value))
+}
+
+func (sp spanner) VisitBinaryExpr(expr *Binary) interface{} {
+	return ExprSpan(expr.Left).Join(ExprSpan(expr.Right))
+}
+
+func (sp spanner) VisitCallExpr(expr *Call) interface{} {
+	return ExprSpan(expr.Callee).Join(expr.Paren.Span())
+}
+
+func (sp spanner) VisitGetExpr(expr *Get) interface{} {
+	return ExprSpan(expr.Object).Join(expr.Name.Span())
+}
+
+func (sp spanner) VisitGroupingExpr(expr *Grouping) interface{} {
+	return expr.LeftParen.Span().Join(expr.RightParen.Span())
+}
+
+func (sp spanner) VisitLiteralExpr(expr *Literal) interface{} {
+	return expr.Span
+}
+
+func (sp spanner) VisitLogicalExpr(expr *Logical) interface{} {
+	return ExprSpan(expr.Left).Join(ExprSpan(expr.Right))
+}
+
+func (sp spanner) VisitSetExpr(expr *Set) interface{} {
+	return ExprSpan(expr.Object).Join(ExprSpan(expr.Value))
+}
+
+func (sp spanner) VisitSuperExpr(expr *Super) interface{} {
+	return expr.Keyword.Span().Join(expr.Method.Span())
+}
+
+func (sp spanner) VisitThisExpr(expr *This) interface{} {
+	return expr.Keyword.Span()
+}
+
+func (sp spanner) VisitUnaryExpr(expr *Unary) interface{} {
+	return expr.Operator.Span().Join(ExprSpan(expr.Right))
+}
+
+func (sp spanner) VisitVariableExpr(expr *Variable) interface{} {
+	return expr.Name.Span()
+}
@@ -9,14 +9,37 @@ type Token struct {
 	Lexeme  string
 	Literal any
 	Line    int
+	// Column is the 1-based column of the first character on Line.
+	Column int
+	// Offset is the byte offset of the lexeme in the source.
+	Offset int
+	// Source is the text the token was scanned from.
+	Source *Source
 }
 
-func NewToken(tokenType TokenType, lexeme string, literal any, line int) *Token {
+func NewToken(tokenType TokenType, lexeme string, literal any, line, column, offset int) *Token {
 	return &Token{
 		Type:    tokenType,
 		Lexeme:  lexeme,
 		Literal: literal,
 		Line:    line,
+		Column:  column,
+		Offset:  offset,
+	}
+}
+
+// Span covers the lexeme of the token. Tokens the parser synthesizes have
+// no position and give an unknown span.
+func (t *Token) Span() Span {
+	if t.Line == 0 {
+		return Span{}
+	}
+	return Span{
+		Start:  t.Offset,
+		End:    t.Offset + len(t.Lexeme),
+		Line:   t.Line,
+		Column: t.Column,
+		Source: t.Source,
 	}
 }
 
@@ -56,6 +79,7 @@ const (
 	SEMICOLON
 	SLASH
 	STAR
+	PERCENT
 
 	// One or two character tokens.
 	BANG
@@ -117,6 +141,8 @@ func (t TokenType) String() string {
 		return "SLASH"
 	case STAR:
 		return "STAR"
+	case PERCENT:
+		return "PERCENT"
 	case BANG:
 		return "BANG"
 	case BANG_EQUAL:
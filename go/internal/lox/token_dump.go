@@ -0,0 +1,89 @@
+package lox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+// tokenJSON is how WriteTokenJSON encodes a token.
+type tokenJSON struct {
+	Type        string `json:"type"`
+	Lexeme      string `json:"lexeme"`
+	Literal     any    `json:"literal"`
+	LiteralType string `json:"literalType,omitempty"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+}
+
+// WriteTokenTable prints tokens one per row in aligned columns.
+func WriteTokenTable(w io.Writer, tokens []Token) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "LINE:COL\tTYPE\tLEXEME\tLITERAL")
+	for _, token := range tokens {
+		fmt.Fprintf(table, "%d:%d\t%s\t%s\t%s\n",
+			token.Line, token.Column, token.Type, cellText(token.Lexeme), literalText(token.Literal))
+	}
+	return table.Flush()
+}
+
+// WriteTokenJSON prints tokens as JSON lines, one object per token with
+// its type, lexeme, literal, line and column. Literals are tagged with
+// their type, "int", "float" or "string", since JSON writes the float 2.0
+// as 2.
+func WriteTokenJSON(w io.Writer, tokens []Token) error {
+	encoder := json.NewEncoder(w)
+	for _, token := range tokens {
+		err := encoder.Encode(tokenJSON{
+			Type:        token.Type.String(),
+			Lexeme:      token.Lexeme,
+			Literal:     token.Literal,
+			LiteralType: literalType(token.Literal),
+			Line:        token.Line,
+			Column:      token.Column,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cellText quotes text that would break a table row, like the newlines in
+// a multi-line string.
+func cellText(text string) string {
+	if strings.ContainsFunc(text, func(r rune) bool { return !unicode.IsPrint(r) }) {
+		return strconv.Quote(text)
+	}
+	return text
+}
+
+// literalType names the type of a token's literal, or is empty for tokens
+// without one.
+func literalType(literal any) string {
+	switch literal.(type) {
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	}
+	return ""
+}
+
+func literalText(literal any) string {
+	switch v := literal.(type) {
+	case nil:
+		return ""
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return formatFloat(v)
+	}
+	return fmt.Sprint(literal)
+}
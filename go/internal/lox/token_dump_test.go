@@ -0,0 +1,45 @@
+package lox
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func scanTokens(t *testing.T, source string) []Token {
+	t.Helper()
+	reporter := NewReporter(io.Discard, "<test>", source)
+	scanner := NewScanner(strings.NewReader(source), reporter)
+	var tokens []Token
+	for {
+		token, err := scanner.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+		if token.Type == EOF {
+			return tokens
+		}
+	}
+}
+
+func TestWriteTokenJSON(t *testing.T) {
+	var out strings.Builder
+	if err := WriteTokenJSON(&out, scanTokens(t, "x = 2.0 + 2 + \"2\";")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"type":"IDENTIFIER","lexeme":"x","literal":null,"line":1,"column":1}
+{"type":"EQUAL","lexeme":"=","literal":null,"line":1,"column":3}
+{"type":"NUMBER","lexeme":"2.0","literal":2,"literalType":"float","line":1,"column":5}
+{"type":"PLUS","lexeme":"+","literal":null,"line":1,"column":9}
+{"type":"NUMBER","lexeme":"2","literal":2,"literalType":"int","line":1,"column":11}
+{"type":"PLUS","lexeme":"+","literal":null,"line":1,"column":13}
+{"type":"STRING","lexeme":"\"2\"","literal":"2","literalType":"string","line":1,"column":15}
+{"type":"SEMICOLON","lexeme":";","literal":null,"line":1,"column":18}
+{"type":"EOF","lexeme":"","literal":null,"line":1,"column":19}
+`
+	if got := out.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
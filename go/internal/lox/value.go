@@ -0,0 +1,255 @@
+package lox
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type ValueType byte
+
+const (
+	VAL_NIL ValueType = iota
+	VAL_BOOL
+	VAL_INT
+	VAL_NUMBER
+	VAL_OBJ
+)
+
+// Value is how the VM represents a Lox value. Numbers and booleans live
+// inline so arithmetic doesn't allocate, everything else is an Obj.
+// VAL_NUMBER is a float, VAL_INT an int.
+type Value struct {
+	Type    ValueType
+	boolean bool
+	integer int64
+	number  float64
+	obj     Obj
+}
+
+func nilValue() Value {
+	return Value{Type: VAL_NIL}
+}
+
+func boolValue(b bool) Value {
+	return Value{Type: VAL_BOOL, boolean: b}
+}
+
+func intValue(n int64) Value {
+	return Value{Type: VAL_INT, integer: n}
+}
+
+func numberValue(n float64) Value {
+	return Value{Type: VAL_NUMBER, number: n}
+}
+
+func objValue(obj Obj) Value {
+	return Value{Type: VAL_OBJ, obj: obj}
+}
+
+// isNumber is true for ints and floats.
+func (v Value) isNumber() bool {
+	return v.Type == VAL_NUMBER || v.Type == VAL_INT
+}
+
+// asFloat converts a number, int or float, to a float.
+func (v Value) asFloat() float64 {
+	if v.Type == VAL_INT {
+		return float64(v.integer)
+	}
+	return v.number
+}
+
+func (v Value) asString() (*ObjString, bool) {
+	if v.Type != VAL_OBJ {
+		return nil, false
+	}
+	str, ok := v.obj.(*ObjString)
+	return str, ok
+}
+
+func (v Value) asInstance() (*ObjInstance, bool) {
+	if v.Type != VAL_OBJ {
+		return nil, false
+	}
+	instance, ok := v.obj.(*ObjInstance)
+	return instance, ok
+}
+
+func (v Value) asClass() (*ObjClass, bool) {
+	if v.Type != VAL_OBJ {
+		return nil, false
+	}
+	class, ok := v.obj.(*ObjClass)
+	return class, ok
+}
+
+func (v Value) isFalsey() bool {
+	return v.Type == VAL_NIL || (v.Type == VAL_BOOL && !v.boolean)
+}
+
+// valuesEqual compares numbers by value, so 1 == 1.0, and objects by
+// identity, which works for strings too because the VM interns them.
+func valuesEqual(a, b Value) bool {
+	if a.isNumber() && b.isNumber() && a.Type != b.Type {
+		return a.asFloat() == b.asFloat()
+	}
+	if a.Type != b.Type {
+		return false
+	}
+	switch a.Type {
+	case VAL_NIL:
+		return true
+	case VAL_BOOL:
+		return a.boolean == b.boolean
+	case VAL_INT:
+		return a.integer == b.integer
+	case VAL_NUMBER:
+		return a.number == b.number
+	default:
+		return a.obj == b.obj
+	}
+}
+
+// Any converts the value to the representation the Interpreter uses, which
+// is also what native functions receive.
+func (v Value) Any() any {
+	switch v.Type {
+	case VAL_BOOL:
+		return v.boolean
+	case VAL_INT:
+		return v.integer
+	case VAL_NUMBER:
+		return v.number
+	case VAL_OBJ:
+		if str, ok := v.obj.(*ObjString); ok {
+			return str.Chars
+		}
+		return v.obj
+	default:
+		return nil
+	}
+}
+
+func (v Value) String() string {
+	switch v.Type {
+	case VAL_BOOL:
+		return fmt.Sprintf("%v", v.boolean)
+	case VAL_INT:
+		return strconv.FormatInt(v.integer, 10)
+	case VAL_NUMBER:
+		return formatFloat(v.number)
+	case VAL_OBJ:
+		return v.obj.String()
+	default:
+		return "nil"
+	}
+}
+
+// Obj is any value the VM allocates on the heap.
+type Obj interface {
+	String() string
+	header() *objHeader
+}
+
+// objHeader is the bookkeeping the collector keeps in every object.
+type objHeader struct {
+	isMarked bool
+	// size is what the object counted towards the heap when allocated
+	size int
+}
+
+func (h *objHeader) header() *objHeader {
+	return h
+}
+
+type ObjString struct {
+	objHeader
+	Chars string
+}
+
+func (s *ObjString) String() string {
+	return s.Chars
+}
+
+// ObjFunction is the compiled prototype of a function. Closures created at
+// runtime share it.
+type ObjFunction struct {
+	objHeader
+	Arity        int
+	UpvalueCount int
+	Chunk        *Chunk
+	Name         *ObjString
+}
+
+func (f *ObjFunction) String() string {
+	if f.Name == nil {
+		return "<script>"
+	}
+	return "<fn " + f.Name.Chars + ">"
+}
+
+type ObjNative struct {
+	objHeader
+	Name  string
+	Arity int
+	Fn    NativeFn
+}
+
+func (n *ObjNative) String() string {
+	return "<native fn " + n.Name + ">"
+}
+
+type ObjClosure struct {
+	objHeader
+	Function *ObjFunction
+	Upvalues []*ObjUpvalue
+}
+
+func (c *ObjClosure) String() string {
+	return c.Function.String()
+}
+
+// ObjUpvalue refers to a variable captured by a closure. While open it
+// points at the variable's stack slot, once closed it holds the value.
+type ObjUpvalue struct {
+	objHeader
+	slot     int
+	closed   Value
+	isClosed bool
+	// next links the VM's open upvalues, sorted by slot from the top down
+	next *ObjUpvalue
+}
+
+func (u *ObjUpvalue) String() string {
+	return "upvalue"
+}
+
+type ObjClass struct {
+	objHeader
+	Name    *ObjString
+	Methods map[*ObjString]*ObjClosure
+}
+
+func (c *ObjClass) String() string {
+	return c.Name.Chars
+}
+
+type ObjInstance struct {
+	objHeader
+	Class  *ObjClass
+	Fields map[*ObjString]Value
+}
+
+func (i *ObjInstance) String() string {
+	return i.Class.Name.Chars + " instance"
+}
+
+type ObjBoundMethod struct {
+	objHeader
+	Receiver Value
+	Method   *ObjClosure
+}
+
+func (b *ObjBoundMethod) String() string {
+	return b.Method.String()
+}
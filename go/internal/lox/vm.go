@@ -0,0 +1,740 @@
+package lox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+	"unsafe"
+)
+
+// framesMax bounds the call depth before the VM reports a stack overflow.
+const framesMax = 4096
+
+// stackInitial is the value stack's starting capacity. It grows as deep
+// calls need it, up to 256 slots for each of framesMax frames, rather than
+// every VM allocating all of that up front.
+const stackInitial = 4 * (maxByteOperand + 1)
+
+// contextCheckInterval is how many backward jumps and calls the VM runs
+// between checks for cancellation.
+const contextCheckInterval = 1 << 10
+
+type callFrame struct {
+	closure *ObjClosure
+	ip      int
+	// slots is the stack index of the frame's slot zero
+	slots int
+}
+
+func (f *callFrame) readByte() byte {
+	b := f.closure.Function.Chunk.Code[f.ip]
+	f.ip++
+	return b
+}
+
+func (f *callFrame) readShort() int {
+	code := f.closure.Function.Chunk.Code
+	f.ip += 2
+	return int(code[f.ip-2])<<8 | int(code[f.ip-1])
+}
+
+// readConstant reads the constant that op's operand indexes, three bytes
+// wide for the long forms.
+func (f *callFrame) readConstant(op OpCode) Value {
+	index := int(f.readByte())
+	if op.isLong() {
+		index = index<<16 | int(f.readByte())<<8 | int(f.readByte())
+	}
+	return f.closure.Function.Chunk.Constants[index]
+}
+
+func (f *callFrame) readString(op OpCode) *ObjString {
+	return f.readConstant(op).obj.(*ObjString)
+}
+
+// VM executes the bytecode produced by the Compiler. Globals persist across
+// calls to Interpret.
+type VM struct {
+	frames     [framesMax]callFrame
+	frameCount int
+
+	stack        []Value
+	globals      map[*ObjString]Value
+	strings      map[string]*ObjString
+	openUpvalues *ObjUpvalue
+	initString   *ObjString
+	gcStatsClass *ObjClass
+
+	// GCStress collects before every allocation to flush out objects that
+	// aren't reachable from a root when they should be.
+	GCStress bool
+	// HeapGrowFactor scales the heap that survived a collection into the
+	// threshold for the next one, DefaultHeapGrowFactor when unset.
+	HeapGrowFactor float64
+
+	objects        []Obj
+	grayStack      []Obj
+	compiler       *Compiler
+	bytesAllocated int
+	nextGC         int
+	collections    int
+	bytesFreed     int
+
+	// Trace, when set, receives the value stack and the disassembled
+	// instruction before every instruction executes.
+	Trace io.Writer
+
+	stdout io.Writer
+	ctx    context.Context
+	ticks  int
+}
+
+func NewVM(stdout io.Writer) *VM {
+	vm := &VM{
+		stack:   make([]Value, 0, stackInitial),
+		globals: make(map[*ObjString]Value),
+		strings: make(map[string]*ObjString),
+		stdout:  stdout,
+		ctx:     context.Background(),
+
+		HeapGrowFactor: DefaultHeapGrowFactor,
+		nextGC:         initialNextGC,
+	}
+	vm.initString = vm.copyString("init")
+	vm.defineNatives()
+	return vm
+}
+
+// DefineNative exposes a Go function to scripts as a global named name.
+func (vm *VM) DefineNative(name string, arity int, fn NativeFn) {
+	// Both objects stay on the stack so neither is collected mid-definition
+	vm.push(objValue(vm.copyString(name)))
+	vm.push(objValue(vm.newNative(name, arity, fn)))
+	vm.globals[vm.peek(1).obj.(*ObjString)] = vm.peek(0)
+	vm.pop()
+	vm.pop()
+}
+
+func (vm *VM) defineNatives() {
+	vm.DefineNative("clock", 0, func(arguments []any) (any, error) {
+		return float64(time.Now().UnixNano()) / float64(time.Second), nil
+	})
+	// gcStats reports this VM's heap, while the Interpreter's reports Go's
+	// runtime.MemStats
+	vm.DefineNative("gcStats", 0, func(arguments []any) (any, error) {
+		return vm.gcStatsInstance(), nil
+	})
+}
+
+// Interpret runs a compiled script and returns the value it returns. It
+// fails with a *RuntimeError, which wraps ctx.Err() when ctx is done.
+func (vm *VM) Interpret(ctx context.Context, script *ObjFunction) (Value, error) {
+	vm.ctx = ctx
+	defer func() {
+		vm.ctx = context.Background()
+	}()
+
+	// The script is only reachable from here until its closure exists
+	vm.push(objValue(script))
+	closure := vm.newClosure(script)
+	vm.pop()
+	vm.push(objValue(closure))
+	if err := vm.call(closure, 0); err != nil {
+		return nilValue(), err
+	}
+	return vm.run()
+}
+
+func (vm *VM) run() (Value, error) {
+	frame := &vm.frames[vm.frameCount-1]
+
+	for {
+		if vm.Trace != nil {
+			fmt.Fprintln(vm.Trace, traceStack(vm.stack))
+			DisassembleInstruction(vm.Trace, frame.closure.Function.Chunk, frame.ip)
+		}
+
+		instruction := OpCode(frame.readByte())
+		switch instruction {
+		case OP_CONSTANT, OP_CONSTANT_LONG:
+			vm.push(frame.readConstant(instruction))
+		case OP_NIL:
+			vm.push(nilValue())
+		case OP_TRUE:
+			vm.push(boolValue(true))
+		case OP_FALSE:
+			vm.push(boolValue(false))
+		case OP_POP:
+			vm.pop()
+
+		case OP_GET_LOCAL:
+			slot := int(frame.readByte())
+			vm.push(vm.stack[frame.slots+slot])
+		case OP_SET_LOCAL:
+			slot := int(frame.readByte())
+			vm.stack[frame.slots+slot] = vm.peek(0)
+		case OP_GET_GLOBAL, OP_GET_GLOBAL_LONG:
+			name := frame.readString(instruction)
+			value, ok := vm.globals[name]
+			if !ok {
+				return nilValue(), vm.runtimeError("Undefined variable '%s'.", name.Chars)
+			}
+			vm.push(value)
+		case OP_DEFINE_GLOBAL, OP_DEFINE_GLOBAL_LONG:
+			name := frame.readString(instruction)
+			vm.globals[name] = vm.peek(0)
+			vm.pop()
+		case OP_SET_GLOBAL, OP_SET_GLOBAL_LONG:
+			name := frame.readString(instruction)
+			if _, ok := vm.globals[name]; !ok {
+				return nilValue(), vm.runtimeError("Undefined variable '%s'.", name.Chars)
+			}
+			vm.globals[name] = vm.peek(0)
+		case OP_GET_UPVALUE:
+			slot := frame.readByte()
+			vm.push(vm.upvalueGet(frame.closure.Upvalues[slot]))
+		case OP_SET_UPVALUE:
+			slot := frame.readByte()
+			vm.upvalueSet(frame.closure.Upvalues[slot], vm.peek(0))
+
+		case OP_GET_PROPERTY, OP_GET_PROPERTY_LONG:
+			instance, ok := vm.peek(0).asInstance()
+			if !ok {
+				return nilValue(), vm.runtimeError("Only instances have properties.")
+			}
+
+			name := frame.readString(instruction)
+			if value, ok := instance.Fields[name]; ok {
+				vm.pop()
+				vm.push(value)
+				break
+			}
+			if err := vm.bindMethod(instance.Class, name); err != nil {
+				return nilValue(), err
+			}
+		case OP_SET_PROPERTY, OP_SET_PROPERTY_LONG:
+			instance, ok := vm.peek(1).asInstance()
+			if !ok {
+				return nilValue(), vm.runtimeError("Only instances have fields.")
+			}
+
+			name := frame.readString(instruction)
+			if _, ok := instance.Fields[name]; !ok {
+				vm.grow(instance, fieldSize)
+			}
+			instance.Fields[name] = vm.peek(0)
+			value := vm.pop()
+			vm.pop()
+			vm.push(value)
+		case OP_GET_SUPER, OP_GET_SUPER_LONG:
+			name := frame.readString(instruction)
+			superclass := vm.pop().obj.(*ObjClass)
+			if err := vm.bindMethod(superclass, name); err != nil {
+				return nilValue(), err
+			}
+
+		case OP_EQUAL:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(boolValue(valuesEqual(a, b)))
+		case OP_GREATER, OP_LESS:
+			if !vm.peek(0).isNumber() || !vm.peek(1).isNumber() {
+				return nilValue(), vm.runtimeError("Operands must be numbers.")
+			}
+			b := vm.pop()
+			a := vm.pop()
+			op := GREATER
+			if instruction == OP_LESS {
+				op = LESS
+			}
+			if a.Type == VAL_INT && b.Type == VAL_INT {
+				vm.push(boolValue(compareNumbers(op, a.integer, b.integer)))
+			} else {
+				vm.push(boolValue(compareNumbers(op, a.asFloat(), b.asFloat())))
+			}
+		case OP_SUBTRACT, OP_MULTIPLY, OP_DIVIDE, OP_MODULO:
+			if !vm.peek(0).isNumber() || !vm.peek(1).isNumber() {
+				return nilValue(), vm.runtimeError("Operands must be numbers.")
+			}
+			if err := vm.arithmetic(instruction); err != nil {
+				return nilValue(), err
+			}
+		case OP_ADD:
+			if err := vm.add(); err != nil {
+				return nilValue(), err
+			}
+		case OP_NOT:
+			vm.push(boolValue(vm.pop().isFalsey()))
+		case OP_NEGATE:
+			if !vm.peek(0).isNumber() {
+				return nilValue(), vm.runtimeError("Operand must be a number.")
+			}
+			value := vm.pop()
+			if value.Type != VAL_INT {
+				vm.push(numberValue(-value.number))
+				break
+			}
+			negated, err := intArithmetic(MINUS, 0, value.integer)
+			if err != nil {
+				return nilValue(), vm.runtimeError("%s", err.Error())
+			}
+			vm.push(intValue(negated))
+
+		case OP_PRINT:
+			fmt.Fprintln(vm.stdout, vm.pop().String())
+
+		case OP_JUMP:
+			offset := frame.readShort()
+			frame.ip += offset
+		case OP_JUMP_IF_FALSE:
+			offset := frame.readShort()
+			if vm.peek(0).isFalsey() {
+				frame.ip += offset
+			}
+		case OP_LOOP:
+			offset := frame.readShort()
+			frame.ip -= offset
+			if err := vm.checkContext(); err != nil {
+				return nilValue(), err
+			}
+
+		case OP_CALL:
+			argCount := int(frame.readByte())
+			if err := vm.checkContext(); err != nil {
+				return nilValue(), err
+			}
+			if err := vm.callValue(vm.peek(argCount), argCount); err != nil {
+				return nilValue(), err
+			}
+			frame = &vm.frames[vm.frameCount-1]
+		case OP_INVOKE, OP_INVOKE_LONG:
+			method := frame.readString(instruction)
+			argCount := int(frame.readByte())
+			if err := vm.checkContext(); err != nil {
+				return nilValue(), err
+			}
+			if err := vm.invoke(instruction, method, argCount); err != nil {
+				return nilValue(), err
+			}
+			frame = &vm.frames[vm.frameCount-1]
+		case OP_SUPER_INVOKE, OP_SUPER_INVOKE_LONG:
+			method := frame.readString(instruction)
+			argCount := int(frame.readByte())
+			superclass := vm.pop().obj.(*ObjClass)
+			if err := vm.invokeFromClass(superclass, method, argCount); err != nil {
+				return nilValue(), err
+			}
+			frame = &vm.frames[vm.frameCount-1]
+
+		case OP_CLOSURE, OP_CLOSURE_LONG:
+			function := frame.readConstant(instruction).obj.(*ObjFunction)
+			closure := vm.newClosure(function)
+			vm.push(objValue(closure))
+			for idx := range closure.Upvalues {
+				isLocal := frame.readByte()
+				index := int(frame.readByte())
+				if isLocal == 1 {
+					closure.Upvalues[idx] = vm.captureUpvalue(frame.slots + index)
+				} else {
+					closure.Upvalues[idx] = frame.closure.Upvalues[index]
+				}
+			}
+		case OP_CLOSE_UPVALUE:
+			vm.closeUpvalues(len(vm.stack) - 1)
+			vm.pop()
+
+		case OP_RETURN:
+			result := vm.pop()
+			vm.closeUpvalues(frame.slots)
+			vm.frameCount--
+			if vm.frameCount == 0 {
+				vm.stack = vm.stack[:0]
+				return result, nil
+			}
+
+			vm.stack = vm.stack[:frame.slots]
+			vm.push(result)
+			frame = &vm.frames[vm.frameCount-1]
+
+		case OP_CLASS, OP_CLASS_LONG:
+			vm.push(objValue(vm.newClass(frame.readString(instruction))))
+		case OP_INHERIT:
+			superclass, ok := vm.peek(1).asClass()
+			if !ok {
+				return nilValue(), vm.runtimeError("Superclass must be a class.")
+			}
+
+			// Copy-down inheritance, methods can't change after declaration
+			subclass := vm.peek(0).obj.(*ObjClass)
+			for name, method := range superclass.Methods {
+				subclass.Methods[name] = method
+			}
+			vm.grow(subclass, len(superclass.Methods)*fieldSize)
+			vm.pop()
+		case OP_METHOD, OP_METHOD_LONG:
+			name := frame.readString(instruction)
+			method := vm.peek(0).obj.(*ObjClosure)
+			class := vm.peek(1).obj.(*ObjClass)
+			if _, ok := class.Methods[name]; !ok {
+				vm.grow(class, fieldSize)
+			}
+			class.Methods[name] = method
+			vm.pop()
+
+		default:
+			return nilValue(), vm.runtimeError("Unknown opcode %d.", instruction)
+		}
+	}
+}
+
+func (vm *VM) add() error {
+	b, a := vm.peek(0), vm.peek(1)
+	if a.isNumber() && b.isNumber() {
+		return vm.arithmetic(OP_ADD)
+	}
+
+	aString, aOk := a.asString()
+	bString, bOk := b.asString()
+	if aOk && bOk {
+		vm.pop()
+		vm.pop()
+		vm.push(objValue(vm.copyString(aString.Chars + bString.Chars)))
+		return nil
+	}
+	return vm.runtimeError("Operands must be two numbers or two strings.")
+}
+
+// arithmetic replaces the two numbers on top of the stack with the result
+// of instruction, promoting to float unless both are ints.
+func (vm *VM) arithmetic(instruction OpCode) error {
+	var op TokenType
+	switch instruction {
+	case OP_ADD:
+		op = PLUS
+	case OP_SUBTRACT:
+		op = MINUS
+	case OP_MULTIPLY:
+		op = STAR
+	case OP_DIVIDE:
+		op = SLASH
+	case OP_MODULO:
+		op = PERCENT
+	}
+
+	b := vm.pop()
+	a := vm.pop()
+	if a.Type == VAL_INT && b.Type == VAL_INT {
+		result, err := intArithmetic(op, a.integer, b.integer)
+		if err != nil {
+			return vm.runtimeError("%s", err.Error())
+		}
+		vm.push(intValue(result))
+		return nil
+	}
+
+	result, err := floatArithmetic(op, a.asFloat(), b.asFloat())
+	if err != nil {
+		return vm.runtimeError("%s", err.Error())
+	}
+	vm.push(numberValue(result))
+	return nil
+}
+
+// Calls
+func (vm *VM) callValue(callee Value, argCount int) error {
+	if callee.Type == VAL_OBJ {
+		switch obj := callee.obj.(type) {
+		case *ObjBoundMethod:
+			vm.stack[len(vm.stack)-argCount-1] = obj.Receiver
+			return vm.call(obj.Method, argCount)
+		case *ObjClass:
+			vm.stack[len(vm.stack)-argCount-1] = objValue(vm.newInstance(obj))
+			if initializer, ok := obj.Methods[vm.initString]; ok {
+				return vm.call(initializer, argCount)
+			}
+			if argCount != 0 {
+				return vm.runtimeError("Expected 0 arguments but got %d.", argCount)
+			}
+			return nil
+		case *ObjClosure:
+			return vm.call(obj, argCount)
+		case *ObjNative:
+			return vm.callNative(obj, argCount)
+		}
+	}
+	return vm.runtimeError("Can only call functions and classes.")
+}
+
+func (vm *VM) call(closure *ObjClosure, argCount int) error {
+	if argCount != closure.Function.Arity {
+		return vm.runtimeError("Expected %d arguments but got %d.", closure.Function.Arity, argCount)
+	}
+	if vm.frameCount == framesMax {
+		return vm.runtimeError("Stack overflow.")
+	}
+
+	frame := &vm.frames[vm.frameCount]
+	vm.frameCount++
+	frame.closure = closure
+	frame.ip = 0
+	frame.slots = len(vm.stack) - argCount - 1
+	return nil
+}
+
+func (vm *VM) callNative(native *ObjNative, argCount int) error {
+	if argCount != native.Arity {
+		return vm.runtimeError("Expected %d arguments but got %d.", native.Arity, argCount)
+	}
+
+	arguments := make([]any, argCount)
+	for idx, argument := range vm.stack[len(vm.stack)-argCount:] {
+		arguments[idx] = argument.Any()
+	}
+
+	result, err := native.Fn(arguments)
+	if err == nil {
+		result, err = nativeResult(result)
+	}
+	if err != nil {
+		return vm.runtimeError("%s", err.Error())
+	}
+	value, err := vm.fromAny(result)
+	if err != nil {
+		return vm.runtimeError("%s", err.Error())
+	}
+
+	vm.stack = vm.stack[:len(vm.stack)-argCount-1]
+	vm.push(value)
+	return nil
+}
+
+// invoke calls the method name on the receiver below the arguments. op is
+// the invoke instruction, whose bytes carry the spans of its errors.
+func (vm *VM) invoke(op OpCode, name *ObjString, argCount int) error {
+	instance, ok := vm.peek(argCount).asInstance()
+	if !ok {
+		// At the opcode, whose span is the receiver and method name
+		return vm.runtimeErrorAt(op.constantWidth()+2, "Only instances have properties.")
+	}
+
+	// A field holding a function shadows a method of the same name
+	if value, ok := instance.Fields[name]; ok {
+		vm.stack[len(vm.stack)-argCount-1] = value
+		return vm.callValue(value, argCount)
+	}
+	return vm.invokeFromClass(instance.Class, name, argCount)
+}
+
+func (vm *VM) invokeFromClass(class *ObjClass, name *ObjString, argCount int) error {
+	method, ok := class.Methods[name]
+	if !ok {
+		// At the name operand, before the argument count
+		return vm.runtimeErrorAt(2, "Undefined property '%s'.", name.Chars)
+	}
+	return vm.call(method, argCount)
+}
+
+// bindMethod replaces the instance on top of the stack with its method name
+// bound to it.
+func (vm *VM) bindMethod(class *ObjClass, name *ObjString) error {
+	method, ok := class.Methods[name]
+	if !ok {
+		return vm.runtimeError("Undefined property '%s'.", name.Chars)
+	}
+
+	bound := vm.newBoundMethod(vm.peek(0), method)
+	vm.pop()
+	vm.push(objValue(bound))
+	return nil
+}
+
+// Upvalues
+func (vm *VM) captureUpvalue(slot int) *ObjUpvalue {
+	var prev *ObjUpvalue
+	upvalue := vm.openUpvalues
+	for upvalue != nil && upvalue.slot > slot {
+		prev = upvalue
+		upvalue = upvalue.next
+	}
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+
+	created := vm.newUpvalue(slot)
+	created.next = upvalue
+	if prev == nil {
+		vm.openUpvalues = created
+	} else {
+		prev.next = created
+	}
+	return created
+}
+
+// closeUpvalues moves every variable at or above the last slot off the
+// stack and into the upvalues that captured it.
+func (vm *VM) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.slot >= last {
+		upvalue := vm.openUpvalues
+		upvalue.closed = vm.stack[upvalue.slot]
+		upvalue.isClosed = true
+		vm.openUpvalues = upvalue.next
+	}
+}
+
+func (vm *VM) upvalueGet(upvalue *ObjUpvalue) Value {
+	if upvalue.isClosed {
+		return upvalue.closed
+	}
+	return vm.stack[upvalue.slot]
+}
+
+func (vm *VM) upvalueSet(upvalue *ObjUpvalue, value Value) {
+	if upvalue.isClosed {
+		upvalue.closed = value
+		return
+	}
+	vm.stack[upvalue.slot] = value
+}
+
+// Allocation
+func (vm *VM) copyString(chars string) *ObjString {
+	if interned, ok := vm.strings[chars]; ok {
+		return interned
+	}
+	str := &ObjString{Chars: chars}
+	vm.allocate(str, int(unsafe.Sizeof(*str))+len(chars))
+	vm.strings[chars] = str
+	return str
+}
+
+func (vm *VM) newFunction() *ObjFunction {
+	function := &ObjFunction{Chunk: NewChunk()}
+	vm.allocate(function, int(unsafe.Sizeof(*function)+unsafe.Sizeof(*function.Chunk)))
+	return function
+}
+
+func (vm *VM) newNative(name string, arity int, fn NativeFn) *ObjNative {
+	native := &ObjNative{
+		Name:  name,
+		Arity: arity,
+		Fn:    fn,
+	}
+	vm.allocate(native, int(unsafe.Sizeof(*native)))
+	return native
+}
+
+func (vm *VM) newClosure(function *ObjFunction) *ObjClosure {
+	closure := &ObjClosure{
+		Function: function,
+		Upvalues: make([]*ObjUpvalue, function.UpvalueCount),
+	}
+	vm.allocate(closure, int(unsafe.Sizeof(*closure))+function.UpvalueCount*int(unsafe.Sizeof(closure)))
+	return closure
+}
+
+func (vm *VM) newUpvalue(slot int) *ObjUpvalue {
+	upvalue := &ObjUpvalue{slot: slot}
+	vm.allocate(upvalue, int(unsafe.Sizeof(*upvalue)))
+	return upvalue
+}
+
+func (vm *VM) newClass(name *ObjString) *ObjClass {
+	class := &ObjClass{
+		Name:    name,
+		Methods: make(map[*ObjString]*ObjClosure),
+	}
+	vm.allocate(class, int(unsafe.Sizeof(*class)))
+	return class
+}
+
+func (vm *VM) newInstance(class *ObjClass) *ObjInstance {
+	instance := &ObjInstance{
+		Class:  class,
+		Fields: make(map[*ObjString]Value),
+	}
+	vm.allocate(instance, int(unsafe.Sizeof(*instance)))
+	return instance
+}
+
+func (vm *VM) newBoundMethod(receiver Value, method *ObjClosure) *ObjBoundMethod {
+	bound := &ObjBoundMethod{
+		Receiver: receiver,
+		Method:   method,
+	}
+	vm.allocate(bound, int(unsafe.Sizeof(*bound)))
+	return bound
+}
+
+// fromAny converts a native function's result back into a Value.
+func (vm *VM) fromAny(value any) (Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return nilValue(), nil
+	case bool:
+		return boolValue(v), nil
+	case int64:
+		return intValue(v), nil
+	case float64:
+		return numberValue(v), nil
+	case string:
+		return objValue(vm.copyString(v)), nil
+	case Obj:
+		return objValue(v), nil
+	}
+	return nilValue(), fmt.Errorf("Native function returned unsupported %T.", value)
+}
+
+// Stack
+func (vm *VM) push(value Value) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() Value {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *VM) peek(distance int) Value {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+func (vm *VM) resetStack() {
+	vm.stack = vm.stack[:0]
+	vm.frameCount = 0
+	vm.openUpvalues = nil
+}
+
+func (vm *VM) checkContext() error {
+	vm.ticks++
+	if vm.ticks%contextCheckInterval != 0 {
+		return nil
+	}
+	if err := vm.ctx.Err(); err != nil {
+		runtimeErr := vm.runtimeError("Execution stopped: %s.", err.Error())
+		runtimeErr.cause = err
+		return runtimeErr
+	}
+	return nil
+}
+
+// runtimeError builds an error located at the last byte read and unwinds
+// the VM so it is ready for the next script.
+func (vm *VM) runtimeError(format string, args ...any) *RuntimeError {
+	return vm.runtimeErrorAt(1, format, args...)
+}
+
+// runtimeErrorAt is runtimeError located back bytes before the next one to
+// read, for instructions whose operands carry the spans of different
+// errors.
+func (vm *VM) runtimeErrorAt(back int, format string, args ...any) *RuntimeError {
+	frame := &vm.frames[vm.frameCount-1]
+	span := frame.closure.Function.Chunk.Span(frame.ip - back)
+
+	vm.resetStack()
+	return &RuntimeError{
+		Message: fmt.Sprintf(format, args...),
+		Span:    span,
+	}
+}
@@ -12,12 +12,37 @@ func NewAST() *AST {
 	return &AST{}
 }
 
+// GenerateAST writes Expr.go and Stmt.go to outputDir. Fields after a "|"
+// aren't taken by the constructor, the Resolver fills them in.
 func (ast *AST) GenerateAST(outputDir string) error {
 	err := ast.defineAst(outputDir, "Expr", []string{
 		"Binary: Expr left, Token operator, Expr right",
-		"Grouping: Expr expression",
-		"Literal: any value",
+		"Call: Expr callee, Token paren, []Expr arguments",
+		"Assign: Token name, Expr value | int depth",
+		"Get: Expr object, Token name",
+		"Grouping: Token leftParen, Expr expression, Token rightParen",
+		"Literal: any value, Token token, Span span",
+		"Logical: Expr left, Token operator, Expr right",
+		"Set: Expr object, Token name, Expr value",
+		"Super: Token keyword, Token method | int depth",
+		"This: Token keyword | int depth",
 		"Unary: Token operator, Expr right",
+		"Variable: Token name | int depth",
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ast.defineAst(outputDir, "Stmt", []string{
+		"Block: []Stmt statements",
+		"Class: Token name, *Variable superclass, []*Function methods",
+		"Expression: Expr expression",
+		"Function: Token name, []Token params, []Stmt body",
+		"If: Expr condition, Stmt thenBranch, Stmt elseBranch",
+		"Print: Expr expression",
+		"Return: Token keyword, Expr value",
+		"Var: Token name, Expr initializer",
+		"While: Expr condition, Stmt body",
 	})
 	return err
 }
@@ -71,15 +96,24 @@ func (ast *AST) defineType(file *os.File, baseName, className, fieldList string)
 		file.WriteString(s + "\n")
 	}
 
+	fieldList, laterList, hasLater := strings.Cut(fieldList, "|")
+
 	// Struct definition
 	write(fmt.Sprintf("\ntype %s struct {", className))
 	fields := strings.Split(fieldList, ",")
-	for _, field := range fields {
-		field = strings.TrimSpace(field)
-		fieldParts := strings.SplitN(field, " ", 2)
-		fieldType := strings.TrimSpace(fieldParts[0])
-		fieldName := strings.TrimSpace(fieldParts[1])
-		write(fmt.Sprintf("    %s %s", capitalize(fieldName), fieldType))
+	writeFields := func(fields []string) {
+		for _, field := range fields {
+			field = strings.TrimSpace(field)
+			fieldParts := strings.SplitN(field, " ", 2)
+			fieldType := strings.TrimSpace(fieldParts[0])
+			fieldName := strings.TrimSpace(fieldParts[1])
+			write(fmt.Sprintf("    %s %s", capitalize(fieldName), fieldType))
+		}
+	}
+	writeFields(fields)
+	if hasLater {
+		write("\n    // Set by the Resolver")
+		writeFields(strings.Split(laterList, ","))
 	}
 	write("}")
 
@@ -102,8 +136,9 @@ func (ast *AST) defineType(file *os.File, baseName, className, fieldList string)
 	write("}")
 
 	// Accept method
-	write(fmt.Sprintf("\nfunc (e *%s) Accept(v %sVisitor) interface{} {", className, baseName))
-	write(fmt.Sprintf("    return v.Visit%s%s(e)", className, baseName))
+	receiver := strings.ToLower(baseName[:1])
+	write(fmt.Sprintf("\nfunc (%s *%s) Accept(v %sVisitor) interface{} {", receiver, className, baseName))
+	write(fmt.Sprintf("    return v.Visit%s%s(%s)", className, baseName, receiver))
 	write("}")
 }
 
@@ -116,7 +151,7 @@ func (ast *AST) defineVisitor(file *os.File, baseName string, types []string) {
 	for _, t := range types {
 		parts := strings.Split(t, ":")
 		className := strings.TrimSpace(parts[0])
-		write(fmt.Sprintf("    Visit%s%s(expr *%s) interface{}", className, baseName, className))
+		write(fmt.Sprintf("    Visit%s%s(%s *%s) interface{}", className, baseName, strings.ToLower(baseName), className))
 	}
 	write("}")
 }
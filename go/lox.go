@@ -0,0 +1,89 @@
+// Package lox embeds the Lox interpreter in Go programs.
+//
+// A Lox keeps its global variables between calls to Run, so a host can
+// define helpers in one script and call them from the next. It is not safe
+// for concurrent use.
+package lox
+
+import (
+	"context"
+	"io"
+
+	_lox "github.com/Shresth72/lox/internal/lox"
+)
+
+// Value is a Lox runtime value: nil, bool, int64, float64, string, or one
+// of the interpreter's callable and instance types.
+type Value = any
+
+// Diagnostic is a static error reported while scanning, parsing or resolving.
+type Diagnostic = _lox.Diagnostic
+
+// RuntimeError is the error returned when a script fails while running.
+type RuntimeError = _lox.RuntimeError
+
+// ErrStatic is returned by Run alongside the diagnostics of a source that
+// could not be compiled.
+var ErrStatic = _lox.ErrStatic
+
+// Options configures a Lox.
+type Options struct {
+	// Stdout receives the output of print statements. Nil discards it.
+	Stdout io.Writer
+	// Stderr receives diagnostics and runtime errors as the command line
+	// tool would print them. Nil discards them.
+	Stderr io.Writer
+	// UseVM compiles scripts to bytecode and runs them on the stack VM
+	// instead of walking the AST.
+	UseVM bool
+}
+
+// Lox runs scripts on one backend, the tree-walking interpreter or the
+// bytecode VM, which it keeps between runs.
+type Lox struct {
+	lox *_lox.Lox
+}
+
+// New returns a Lox that runs on the backend opts selects. The globals a
+// run defines, functions and classes included, persist into later runs on
+// the same Lox. The two backends do not share state: nothing defined on a
+// Lox using the VM is visible to one using the interpreter, or to any other
+// Lox.
+func New(opts Options) *Lox {
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	lox := _lox.NewLox(stdout, stderr)
+	lox.UseVM = opts.UseVM
+	return &Lox{
+		lox: lox,
+	}
+}
+
+// Run executes source and returns the value of its final statement if that
+// is an expression statement. When the source has static errors the
+// diagnostics are returned with ErrStatic and nothing runs. Runtime failures,
+// including ctx being cancelled, are returned as a *RuntimeError.
+func (l *Lox) Run(ctx context.Context, source string) (Value, []Diagnostic, error) {
+	return l.lox.Run(ctx, source)
+}
+
+// RunReader is Run for a script read from r, which is scanned as it is
+// read. name labels the script in the diagnostics written to Stderr. The
+// script's text is kept in memory until the run ends so that errors can
+// quote it.
+func (l *Lox) RunReader(ctx context.Context, name string, r io.Reader) (Value, []Diagnostic, error) {
+	return l.lox.RunReader(ctx, name, r)
+}
+
+// DefineNative exposes fn to scripts as a global function called name that
+// takes exactly arity arguments. fn may return any Go integer or float type,
+// which becomes an int64 or float64. An error returned by fn becomes a
+// runtime error at the call site.
+func (l *Lox) DefineNative(name string, arity int, fn func(arguments []Value) (Value, error)) {
+	l.lox.DefineNative(name, arity, fn)
+}
@@ -0,0 +1,242 @@
+package lox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// TestBackendsAgree runs each script on the Interpreter and the VM, which
+// must both print the expected output and render the expected diagnostics.
+func TestBackendsAgree(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		stdout string
+		stderr string
+	}{
+		{"arithmetic", "print 1 + 2 * 3; print 7 / 2; print 7 % 3; print 1.5 + 1; print 2 - 0.5;", "7\n3\n1\n2.5\n1.5\n", ""},
+		{"negative zero", "print -0.0; print 0.0; print -0.0 == 0.0; print 1 / -0.0;", "-0.0\n0.0\ntrue\n", "error[E0300]: Division by zero.\n --> <script>:1:49\n  |\n1 | print -0.0; print 0.0; print -0.0 == 0.0; print 1 / -0.0;\n  |                                                 ^^^^^^^^\n"},
+		{"strings", `var a = "con"; print a + "cat"; print "a" == "a"; print "a" != "b";`, "concat\ntrue\ntrue\n", ""},
+		{"comparison", "print 1 < 2; print 2 <= 1; print !nil; print nil or false; print 1 and 2;", "true\nfalse\ntrue\nfalse\n2\n", ""},
+		{"loops", "var sum = 0; for (var i = 0; i < 10; i = i + 1) sum = sum + i; print sum;", "45\n", ""},
+		{"closures", `
+fun counter() {
+  var count = 0;
+  fun increment() {
+    count = count + 1;
+    return count;
+  }
+  return increment;
+}
+var next = counter();
+next();
+print next();
+print counter;`, "2\n<fn counter>\n", ""},
+		{"classes", `
+class Shape {
+  init(name) { this.name = name; }
+  describe() { return this.name + " with " + this.sides() + " sides"; }
+}
+class Square < Shape {
+  init() { super.init("square"); }
+  sides() { return "4"; }
+}
+var square = Square();
+print square.describe();
+print square;
+print Square;
+var method = square.sides;
+print method();`, "square with 4 sides\nSquare instance\nSquare\n4\n", ""},
+		{"static error", "print 1 +;", "", "error[E0100]: Expect expression.\n --> <script>:1:10\n  |\n1 | print 1 +;\n  |          ^\n"},
+		{"undefined variable", "print missing;", "", "error[E0300]: Undefined variable 'missing'.\n --> <script>:1:7\n  |\n1 | print missing;\n  |       ^^^^^^^\n"},
+		{"bad operands", `print 1 + "a";`, "", "error[E0300]: Operands must be two numbers or two strings.\n --> <script>:1:7\n  |\n1 | print 1 + \"a\";\n  |       ^^^^^^^\n"},
+		{"bad operand", `print -"a";`, "", "error[E0300]: Operand must be a number.\n --> <script>:1:7\n  |\n1 | print -\"a\";\n  |       ^^^^\n"},
+		{"division by zero", "print 1 / 0;", "", "error[E0300]: Division by zero.\n --> <script>:1:7\n  |\n1 | print 1 / 0;\n  |       ^^^^^\n"},
+		{"not callable", `"str"();`, "", "error[E0300]: Can only call functions and classes.\n --> <script>:1:1\n  |\n1 | \"str\"();\n  | ^^^^^^^\n"},
+		{"wrong arity", "fun f(a) {}\nf(1,\n  2);", "", "error[E0300]: Expected 1 arguments but got 2.\n --> <script>:2:1\n  |\n2 | f(1,\n  | ^^^^\n"},
+		{"property of non-instance", "var x = 3;\nprint x.field;", "", "error[E0300]: Only instances have properties.\n --> <script>:2:7\n  |\n2 | print x.field;\n  |       ^^^^^^^\n"},
+		{"undefined property", "class A {}\nprint A().missing;", "", "error[E0300]: Undefined property 'missing'.\n --> <script>:2:11\n  |\n2 | print A().missing;\n  |           ^^^^^^^\n"},
+		{"undefined method", "class A {}\nA().missing(1);", "", "error[E0300]: Undefined property 'missing'.\n --> <script>:2:5\n  |\n2 | A().missing(1);\n  |     ^^^^^^^\n"},
+		{"method of non-instance", "var s = 1;\ns.len();", "", "error[E0300]: Only instances have properties.\n --> <script>:2:1\n  |\n2 | s.len();\n  | ^^^^^\n"},
+		{"field of non-instance", "var o = 1;\no.f = 2;", "", "error[E0300]: Only instances have fields.\n --> <script>:2:1\n  |\n2 | o.f = 2;\n  | ^^^^^^^\n"},
+		{"undefined super method", "class A {}\nclass B < A { m() { return super.gone(); } }\nB().m();", "", "error[E0300]: Undefined property 'gone'.\n --> <script>:2:28\n  |\n2 | class B < A { m() { return super.gone(); } }\n  |                            ^^^^^^^^^^\n"},
+		{"bad superclass", "var n = 1;\nclass B < n {}", "", "error[E0300]: Superclass must be a class.\n --> <script>:2:11\n  |\n2 | class B < n {}\n  |           ^\n"},
+		{"deep recursion", "fun depth(n) {\n  if (n == 0) return 0;\n  return depth(n - 1) + 1;\n}\nprint depth(3000);", "3000\n", ""},
+		{"shared upvalues", `
+fun pair() {
+  var shared = "before";
+  fun get() { return shared; }
+  fun set(value) { shared = value; }
+  set("after");
+  return get;
+}
+print pair()();
+var fns = nil;
+{
+  var a = 1;
+  fun outer() {
+    var b = 2;
+    fun inner() { return a + b; }
+    return inner;
+  }
+  fns = outer();
+  a = 10;
+}
+print fns();`, "after\n12\n", ""},
+		{"super chain", `
+class A {
+  name() { return "A"; }
+}
+class B < A {
+  name() { return "B>" + super.name(); }
+}
+class C < B {
+  name() { return "C>" + super.name(); }
+  bound() { var m = super.name; return m; }
+}
+print C().name();
+print C().bound()();`, "C>B>A\nB>A\n", ""},
+		{"stack overflow", "fun r(n) { return r(n + 1); }\nr(0);", "", "error[E0300]: Stack overflow.\n --> <script>:1:19\n  |\n1 | fun r(n) { return r(n + 1); }\n  |                   ^^^^^^^^\n"},
+		{"more than 256 constants", manyConstants(300), "300.0\nf\n", "error[E0300]: Undefined property 'missing'.\n   --> <script>:307:9\n    |\n307 | print a.missing;\n    |         ^^^^^^^\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr [2]strings.Builder
+			var errs [2]error
+			for idx, useVM := range []bool{false, true} {
+				l := New(Options{Stdout: &stdout[idx], Stderr: &stderr[idx], UseVM: useVM})
+				_, _, errs[idx] = l.Run(context.Background(), test.source)
+			}
+
+			for idx, backend := range []string{"Interpreter", "VM"} {
+				if failed := errs[idx] != nil; failed != (test.stderr != "") {
+					t.Errorf("%s returned %v", backend, errs[idx])
+				}
+				if got := stdout[idx].String(); got != test.stdout {
+					t.Errorf("%s stdout:\n%s\nwant:\n%s", backend, got, test.stdout)
+				}
+				if got := stderr[idx].String(); got != test.stderr {
+					t.Errorf("%s stderr:\n%s\nwant:\n%s", backend, got, test.stderr)
+				}
+			}
+		})
+	}
+}
+
+// manyConstants returns a script that needs the long instructions, with n
+// number constants and globals ahead of a class, method and property.
+func manyConstants(n int) string {
+	var builder strings.Builder
+	for idx := range n {
+		fmt.Fprintf(&builder, "var g%d = %d.5;\n", idx, idx)
+	}
+	fmt.Fprintf(&builder, "g%d = g%d + g0;\nprint g%d;\n", n-1, n-1, n-1)
+	builder.WriteString("class A { m() { return this.f; } }\nvar a = A();\na.f = \"f\";\nprint a.m();\nprint a.missing;\n")
+	return builder.String()
+}
+
+func TestRunReportsStackOverflow(t *testing.T) {
+	for _, useVM := range []bool{false, true} {
+		l := New(Options{UseVM: useVM})
+		_, _, err := l.Run(context.Background(), "fun r(n) { return r(n + 1); } r(0);")
+
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) {
+			t.Fatalf("UseVM=%v: got error %v, want a *RuntimeError", useVM, err)
+		}
+		if runtimeErr.Message != "Stack overflow." {
+			t.Errorf("UseVM=%v: got message %q, want %q", useVM, runtimeErr.Message, "Stack overflow.")
+		}
+	}
+}
+
+func TestNativeNumberResults(t *testing.T) {
+	tests := []struct {
+		result Value
+		want   string
+	}{
+		{42, "43"},
+		{int8(-8), "-7"},
+		{int16(16), "17"},
+		{int32(32), "33"},
+		{int64(64), "65"},
+		{uint(1), "2"},
+		{uint8(8), "9"},
+		{uint16(16), "17"},
+		{uint32(32), "33"},
+		{uint64(1 << 40), "1099511627777"},
+		{uintptr(3), "4"},
+		{float32(0.5), "1.5"},
+		{2.0, "3.0"},
+	}
+
+	for _, test := range tests {
+		for _, useVM := range []bool{false, true} {
+			var stdout strings.Builder
+			l := New(Options{Stdout: &stdout, UseVM: useVM})
+			l.DefineNative("answer", 0, func(arguments []Value) (Value, error) {
+				return test.result, nil
+			})
+
+			// Integers print without a decimal point, floats with one
+			if _, _, err := l.Run(context.Background(), "print answer() + 1;"); err != nil {
+				t.Fatalf("%T UseVM=%v: %v", test.result, useVM, err)
+			}
+			if want := test.want + "\n"; stdout.String() != want {
+				t.Errorf("%T UseVM=%v: printed %q, want %q", test.result, useVM, stdout.String(), want)
+			}
+		}
+	}
+}
+
+func TestNativeUintTooLarge(t *testing.T) {
+	for _, useVM := range []bool{false, true} {
+		l := New(Options{UseVM: useVM})
+		l.DefineNative("huge", 0, func(arguments []Value) (Value, error) {
+			return uint64(math.MaxUint64), nil
+		})
+
+		_, _, err := l.Run(context.Background(), "huge();")
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || !strings.Contains(runtimeErr.Message, "too large for an int") {
+			t.Errorf("UseVM=%v: got error %v, want one about the int being too large", useVM, err)
+		}
+	}
+}
+
+func TestRuntimeErrorInEarlierRun(t *testing.T) {
+	for _, useVM := range []bool{false, true} {
+		var stderr strings.Builder
+		l := New(Options{Stderr: &stderr, UseVM: useVM})
+		if _, _, err := l.RunReader(context.Background(), "<lib>", strings.NewReader("fun f(x) {\n  return x + \"a\";\n}")); err != nil {
+			t.Fatalf("UseVM=%v: %v", useVM, err)
+		}
+		l.Run(context.Background(), "var unrelated = 1;\nvar other = 22222222;\nf(1);")
+
+		// Only the position, the current run's text is the wrong source
+		want := "error[E0300]: Operands must be two numbers or two strings.\n --> <lib>:2:10\n"
+		if got := stderr.String(); got != want {
+			t.Errorf("UseVM=%v: got\n%s\nwant\n%s", useVM, got, want)
+		}
+	}
+}
+
+func TestRunReaderStreamsScript(t *testing.T) {
+	var stdout, stderr strings.Builder
+	l := New(Options{Stdout: &stdout, Stderr: &stderr})
+	source := "fun f() {\n  print 1;\n}\nf();\nprint 2 +;\n"
+
+	_, diagnostics, err := l.RunReader(context.Background(), "<test>", iotest.OneByteReader(strings.NewReader(source)))
+	if !errors.Is(err, ErrStatic) || len(diagnostics) != 1 {
+		t.Fatalf("got error %v and %d diagnostics, want ErrStatic and 1", err, len(diagnostics))
+	}
+	if want := "5 | print 2 +;\n"; !strings.Contains(stderr.String(), want) {
+		t.Errorf("diagnostic %q does not quote the line %q", stderr.String(), want)
+	}
+}